@@ -0,0 +1,142 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LoggingPolicySpec defines the limits every LoggingSetup must comply with.
+// Unset fields don't restrict anything.
+type LoggingPolicySpec struct {
+
+	// MaxRetentionDays is the maximum retentionDays of the LoggingSetupClass.
+	// Classes without retentionDays are checked with the retention of the IndexSet template
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxRetentionDays *int32 `json:"maxRetentionDays,omitempty"`
+
+	// MaxShards is the maximum number of shards of the LoggingSetupClass.
+	// Classes without shards are checked with the shards of the IndexSet template
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxShards *int32 `json:"maxShards,omitempty"`
+
+	// AllowedRoles are the only Graylog roles the users may get
+	// +optional
+	AllowedRoles []string `json:"allowedRoles,omitempty"`
+
+	// ForbiddenRuleFields are log fields which must not be used as stream rule field
+	// +optional
+	ForbiddenRuleFields []string `json:"forbiddenRuleFields,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// LoggingPolicy is the Schema for the loggingpolicies API
+type LoggingPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LoggingPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LoggingPolicyList contains a list of LoggingPolicy
+type LoggingPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LoggingPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LoggingPolicy{}, &LoggingPolicyList{})
+}
+
+// IndexSetTemplateSettings are the settings of an IndexSet template, used by classes without overrides
+type IndexSetTemplateSettings struct {
+
+	// RetentionDays is nil if the template doesn't delete indices after a number of days
+	RetentionDays *int32
+
+	Shards *int32
+}
+
+// Violations returns a message for each limit of the policy exceeded by the class.
+// class may be nil for the built-in defaults. The settings not overridden by the class are checked with
+// the template, template may be nil if it is unknown, then only the overrides are checked.
+func (policy *LoggingPolicy) Violations(class *LoggingSetupClass, template *IndexSetTemplateSettings) []string {
+
+	var violations []string
+	report := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf("%s: ", policy.Name)+fmt.Sprintf(format, args...))
+	}
+
+	spec := LoggingSetupClassSpec{}
+	if class != nil {
+		spec = class.Spec
+	}
+
+	retentionDays, shards := spec.RetentionDays, spec.Shards
+	if template != nil {
+		if retentionDays == nil {
+			retentionDays = template.RetentionDays
+			if retentionDays == nil && policy.Spec.MaxRetentionDays != nil {
+				report("retention of IndexSet template '%s' is not limited to days", spec.EffectiveIndexSetTemplate())
+			}
+		}
+
+		if shards == nil {
+			shards = template.Shards
+		}
+	}
+
+	if max := policy.Spec.MaxRetentionDays; max != nil && retentionDays != nil && *retentionDays > *max {
+		report("retentionDays %d exceeds the maximum of %d", *retentionDays, *max)
+	}
+
+	if max := policy.Spec.MaxShards; max != nil && shards != nil && *shards > *max {
+		report("shards %d exceeds the maximum of %d", *shards, *max)
+	}
+
+	if len(policy.Spec.AllowedRoles) > 0 {
+		for _, role := range spec.EffectiveRoles() {
+			if !containsString(policy.Spec.AllowedRoles, role) {
+				report("role '%s' is not allowed", role)
+			}
+		}
+	}
+
+	if field := spec.Stream.EffectiveRuleFieldName(); containsString(policy.Spec.ForbiddenRuleFields, field) {
+		report("stream rule field '%s' is forbidden", field)
+	}
+
+	return violations
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
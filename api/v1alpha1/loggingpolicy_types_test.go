@@ -0,0 +1,80 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestViolations(t *testing.T) {
+
+	policy := &LoggingPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+		Spec: LoggingPolicySpec{
+			MaxRetentionDays:    int32Ptr(30),
+			MaxShards:           int32Ptr(2),
+			AllowedRoles:        []string{"Reader", "Dashboard Creator"},
+			ForbiddenRuleFields: []string{"source"},
+		},
+	}
+
+	class := func(spec LoggingSetupClassSpec) *LoggingSetupClass {
+		return &LoggingSetupClass{Spec: spec}
+	}
+
+	tests := []struct {
+		name     string
+		class    *LoggingSetupClass
+		template *IndexSetTemplateSettings
+		expected []string
+	}{
+		{"defaults", nil, nil, nil},
+		{"defaults with compliant template", nil, &IndexSetTemplateSettings{RetentionDays: int32Ptr(14), Shards: int32Ptr(1)}, nil},
+		{"overrides within limits", class(LoggingSetupClassSpec{RetentionDays: int32Ptr(30), Shards: int32Ptr(2)}), nil, nil},
+		{"overrides exceeding limits", class(LoggingSetupClassSpec{RetentionDays: int32Ptr(31), Shards: int32Ptr(3)}), nil, []string{
+			"limits: retentionDays 31 exceeds the maximum of 30",
+			"limits: shards 3 exceeds the maximum of 2",
+		}},
+		{"template exceeding limits", nil, &IndexSetTemplateSettings{RetentionDays: int32Ptr(90), Shards: int32Ptr(4)}, []string{
+			"limits: retentionDays 90 exceeds the maximum of 30",
+			"limits: shards 4 exceeds the maximum of 2",
+		}},
+		{"overrides of template exceeding limits", class(LoggingSetupClassSpec{RetentionDays: int32Ptr(7), Shards: int32Ptr(1)}), &IndexSetTemplateSettings{RetentionDays: int32Ptr(90), Shards: int32Ptr(4)}, nil},
+		{"template without retention days", nil, &IndexSetTemplateSettings{Shards: int32Ptr(1)}, []string{
+			"limits: retention of IndexSet template 'wd-logging-operator-template' is not limited to days",
+		}},
+		{"roles", class(LoggingSetupClassSpec{Roles: []string{"Reader", "Admin"}}), nil, []string{
+			"limits: role 'Admin' is not allowed",
+		}},
+		{"rule field", class(LoggingSetupClassSpec{Stream: StreamClassSpec{RuleFieldName: "source"}}), nil, []string{
+			"limits: stream rule field 'source' is forbidden",
+		}},
+	}
+
+	for _, test := range tests {
+		if violations := policy.Violations(test.class, test.template); !reflect.DeepEqual(violations, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, violations)
+		}
+	}
+}
@@ -27,6 +27,28 @@ const (
 	Isolation_Namespace = "Namespace"
 )
 
+// +kubebuilder:validation:Enum=Delete;Retain
+type DeletionPolicy string
+
+const (
+	// DeletionPolicy_Delete deletes the Graylog objects with the LoggingSetup
+	DeletionPolicy_Delete = "Delete"
+
+	// DeletionPolicy_Retain keeps the Graylog objects when the LoggingSetup is deleted
+	DeletionPolicy_Retain = "Retain"
+)
+
+const (
+	// ANNOTATION_RESET_PASSWORD triggers a password reset whenever its value changes, e.g. to the current time
+	ANNOTATION_RESET_PASSWORD = "logging.world-direct.at/reset-password"
+
+	// CREDENTIALS_SECRET_SUFFIX is appended to the name of the LoggingSetup for the credentials Secret
+	CREDENTIALS_SECRET_SUFFIX = "-graylog-credentials"
+
+	// TOKENS_SECRET_SUFFIX is appended to the name of the LoggingSetup for the tokens Secret
+	TOKENS_SECRET_SUFFIX = "-graylog-tokens"
+)
+
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
@@ -35,13 +57,81 @@ type LoggingSetupSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
+	// ClassName is the name of the LoggingSetupClass to use.
+	// If empty, the class annotated as default is used, or the built-in defaults if there is none.
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
 	// Isolation allows to choose how the LoggingSetup will be isolated to others.
 	// Currently only 'Namespace' is supported
 	Isolation Isolations `json:"isolation,omitempty"`
 
 	// InitialPassword defines the password used to create the Graylog user.
-	// It is only set when the user is created, you can change it afterwards in Graylog
+	// It is only set when the user is created, you can change it afterwards in Graylog.
+	// If empty, a random password is generated and written to the credentials Secret.
 	InitialUserPassword string `json:"initialUserPassword,omitempty"`
+
+	// DeletionPolicy defines what happens with the Graylog objects when the LoggingSetup is deleted.
+	// 'Delete' (the default) deletes them, 'Retain' keeps them.
+	// The API tokens of the user are revoked with both policies, as their Secret is deleted.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Adopt allows to take over existing Graylog objects instead of creating new ones.
+	// The objects are verified, marked as owned by the operator and managed from then on
+	// like objects created by the operator (including deletion).
+	// Objects already owned by another LoggingSetup are not adopted.
+	// +optional
+	Adopt *AdoptSpec `json:"adopt,omitempty"`
+
+	// User contains optional settings for the Graylog user
+	// +optional
+	User *UserSpec `json:"user,omitempty"`
+
+	// Tokens are Graylog API access tokens created for the user, e.g. for scripts and CI jobs.
+	// They are written to the Secret '<name>-graylog-tokens' and revoked when removed from this list.
+	// +optional
+	Tokens []TokenSpec `json:"tokens,omitempty"`
+}
+
+// TokenSpec defines a Graylog API access token of the user
+type TokenSpec struct {
+
+	// Name of the token, it is also used as the key in the tokens Secret
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	Name string `json:"name"`
+}
+
+// TokenStatus contains a created Graylog API access token
+type TokenStatus struct {
+
+	// Name of the token
+	Name string `json:"name"`
+
+	// ID contains the ID of the token in Graylog
+	ID string `json:"id"`
+}
+
+// UserSpec contains optional settings for the Graylog user
+type UserSpec struct {
+
+	// PasswordRotation is the interval to set a new random password for the Graylog user, e.g. "720h".
+	// The password is written to the credentials Secret '<name>-graylog-credentials'.
+	// +optional
+	PasswordRotation *metav1.Duration `json:"passwordRotation,omitempty"`
+}
+
+// AdoptSpec contains the IDs of existing Graylog objects to adopt
+type AdoptSpec struct {
+
+	// UserID contains the ID of an existing User in Graylog
+	UserID string `json:"userID,omitempty"`
+
+	// IndexSetID contains the ID of an existing IndexSet in Graylog
+	IndexSetID string `json:"indexSetID,omitempty"`
+
+	// StreamID contains the ID of an existing Stream in Graylog
+	StreamID string `json:"streamID,omitempty"`
 }
 
 type GraylogStatus struct {
@@ -54,6 +144,82 @@ type GraylogStatus struct {
 
 	// UserID contains the ID of the Stream in Graylog
 	StreamID string `json:"streamID,omitempty"`
+
+	// Version is the version of the Graylog server the objects have been provisioned in
+	Version string `json:"version,omitempty"`
+
+	// UserRoles contains the roles applied to the user, roles removed from the class are removed from the user
+	UserRoles []string `json:"userRoles,omitempty"`
+}
+
+// UsageStatus contains the message throughput of the Stream and the storage usage of the IndexSet
+type UsageStatus struct {
+
+	// Throughput is the number of messages per second currently routed into the Stream
+	Throughput int64 `json:"throughput"`
+
+	// Indices is the number of indices of the IndexSet
+	Indices int64 `json:"indices"`
+
+	// Documents is the number of messages stored in the IndexSet
+	Documents int64 `json:"documents"`
+
+	// SizeBytes is the size of all indices of the IndexSet in bytes
+	SizeBytes int64 `json:"sizeBytes"`
+
+	// OldestMessage is the time of the oldest message in the IndexSet, as calculated by the index ranges
+	OldestMessage *metav1.Time `json:"oldestMessage,omitempty"`
+
+	// LastUpdated is the time the usage was read from Graylog
+	LastUpdated metav1.Time `json:"lastUpdated"`
+}
+
+// DeliveryProbeStatus contains the state of the end-to-end log delivery probe
+type DeliveryProbeStatus struct {
+
+	// PendingID is the ID of the probe message sent, but not found in the Stream yet
+	PendingID string `json:"pendingID,omitempty"`
+
+	// LastSent is the time the last probe message was sent
+	LastSent *metav1.Time `json:"lastSent,omitempty"`
+
+	// LastVerified is the time the last probe message was found in the Stream
+	LastVerified *metav1.Time `json:"lastVerified,omitempty"`
+
+	// Latency is the time from sending the last verified probe message until Graylog received it
+	Latency *metav1.Duration `json:"latency,omitempty"`
+}
+
+// IngestionEndpoint is an input of Graylog accepting GELF messages
+type IngestionEndpoint struct {
+
+	// Title is the title of the input in Graylog
+	Title string `json:"title"`
+
+	// Host is the host name or address to send the messages to
+	Host string `json:"host"`
+
+	// Port is the port of the input
+	Port int32 `json:"port"`
+
+	// Protocol is one of 'udp', 'tcp' or 'http'
+	Protocol string `json:"protocol"`
+
+	// TLS is set if the input requires TLS
+	TLS bool `json:"tls,omitempty"`
+}
+
+// IngestionStatus tells how to send logs directly to Graylog, so that they are routed into the Stream
+type IngestionStatus struct {
+
+	// Endpoints are the GELF inputs of Graylog
+	Endpoints []IngestionEndpoint `json:"endpoints,omitempty"`
+
+	// Fields are the fields every message must contain with the given values, to match the Stream rules
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// ConfigMapName is the name of the ConfigMap containing the same information
+	ConfigMapName string `json:"configMapName,omitempty"`
 }
 
 // LoggingSetupStatus defines the observed state of LoggingSetup
@@ -64,6 +230,33 @@ type LoggingSetupStatus struct {
 	// UserName Contains the name of the generated User to logon to graylog
 	UserName string `json:"userName,omitempty"`
 
+	// ClassName contains the name of the LoggingSetupClass used for the last provisioning
+	ClassName string `json:"className,omitempty"`
+
+	// ObservedGeneration is the generation of the spec provisioned last
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastProvisioned is the time the Graylog objects were last provisioned successfully
+	LastProvisioned *metav1.Time `json:"lastProvisioned,omitempty"`
+
+	// LastPasswordRotation is the time the password of the user was last set by the operator
+	LastPasswordRotation *metav1.Time `json:"lastPasswordRotation,omitempty"`
+
+	// PasswordResetRequest contains the value of the last handled reset-password annotation
+	PasswordResetRequest string `json:"passwordResetRequest,omitempty"`
+
+	// Tokens contains the created Graylog API access tokens, needed to revoke them
+	Tokens []TokenStatus `json:"tokens,omitempty"`
+
+	// Usage contains the message throughput and storage usage, updated periodically
+	Usage *UsageStatus `json:"usage,omitempty"`
+
+	// DeliveryProbe contains the state of the end-to-end log delivery probe, if enabled
+	DeliveryProbe *DeliveryProbeStatus `json:"deliveryProbe,omitempty"`
+
+	// Ingestion contains the GELF endpoints and fields for applications sending logs directly to Graylog
+	Ingestion *IngestionStatus `json:"ingestion,omitempty"`
+
 	// GraylogStatus contains data needed for Reconcilation, specially generated IDs.
 	// ATTENTION: These values are not stored anywhere elso, so don't change them please.
 	GraylogStatus GraylogStatus `json:"graylogInternal,omitempty"`
@@ -96,3 +289,13 @@ type LoggingSetupList struct {
 func init() {
 	SchemeBuilder.Register(&LoggingSetup{}, &LoggingSetupList{})
 }
+
+// CredentialsSecretName returns the name of the Secret containing the credentials of the Graylog user
+func (r *LoggingSetup) CredentialsSecretName() string {
+	return r.Name + CREDENTIALS_SECRET_SUFFIX
+}
+
+// TokensSecretName returns the name of the Secret containing the access tokens of the Graylog user
+func (r *LoggingSetup) TokensSecretName() string {
+	return r.Name + TOKENS_SECRET_SUFFIX
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var loggingsetuplog = logf.Log.WithName("loggingsetup-resource")
+
+// TemplateResolver returns the settings of the IndexSet template with the given title, nil if it doesn't exist
+type TemplateResolver func(ctx context.Context, title string) (*IndexSetTemplateSettings, error)
+
+// the webhooks have no other way to get a client and the templates, they are set by SetupWebhookWithManager
+var (
+	webhookClient    client.Reader
+	webhookTemplates TemplateResolver
+)
+
+func (r *LoggingSetup) SetupWebhookWithManager(mgr ctrl.Manager, templates TemplateResolver) error {
+	webhookClient = mgr.GetClient()
+	webhookTemplates = templates
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-logging-world-direct-at-v1alpha1-loggingsetup,mutating=false,failurePolicy=fail,sideEffects=None,groups=logging.world-direct.at,resources=loggingsetups,verbs=create;update,versions=v1alpha1,name=vloggingsetup.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &LoggingSetup{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *LoggingSetup) ValidateCreate() error {
+	loggingsetuplog.Info("validate create", "name", r.Name)
+
+	return r.validatePolicies()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// Only changes of the spec are validated, so that objects violating a newer policy can still be finalized.
+func (r *LoggingSetup) ValidateUpdate(old runtime.Object) error {
+	loggingsetuplog.Info("validate update", "name", r.Name)
+
+	if r.DeletionTimestamp != nil {
+		return nil
+	}
+
+	if oldObj, ok := old.(*LoggingSetup); ok && equality.Semantic.DeepEqual(oldObj.Spec, r.Spec) {
+		return nil
+	}
+
+	return r.validatePolicies()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *LoggingSetup) ValidateDelete() error {
+	return nil
+}
+
+func (r *LoggingSetup) validatePolicies() error {
+
+	ctx := context.Background()
+
+	class, err := ResolveClass(ctx, webhookClient, r.Spec.ClassName)
+	if err != nil {
+		// a missing class is reported by the reconciler, it may be created later
+		if _, ok := err.(*ClassNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+
+	violations, err := PolicyViolations(ctx, webhookClient, class, resolveTemplate(ctx, class))
+	if err != nil {
+		return err
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("LoggingSetup violates LoggingPolicies: %s", strings.Join(violations, "; "))
+	}
+
+	return nil
+}
+
+// resolveTemplate returns the settings of the template used by the class, nil if they can't be read.
+// An unreachable Graylog must not block the admission, the reconciler checks the template before provisioning.
+func resolveTemplate(ctx context.Context, class *LoggingSetupClass) *IndexSetTemplateSettings {
+
+	if webhookTemplates == nil {
+		return nil
+	}
+
+	spec := LoggingSetupClassSpec{}
+	if class != nil {
+		spec = class.Spec
+	}
+
+	template, err := webhookTemplates(ctx, spec.EffectiveIndexSetTemplate())
+	if err != nil {
+		loggingsetuplog.Error(err, "Failed to read the IndexSet template, only the overrides are checked", "template", spec.EffectiveIndexSetTemplate())
+		return nil
+	}
+
+	return template
+}
+
+// ClassNotFoundError is returned if the class named by a LoggingSetup doesn't exist
+type ClassNotFoundError struct {
+	Name string
+}
+
+func (e *ClassNotFoundError) Error() string {
+	return "LoggingSetupClass '" + e.Name + "' not found"
+}
+
+// ResolveClass returns the class with the given name, or the default class if the name is empty.
+// Returns nil if no name is given and no default class exists, so the built-in defaults are used.
+func ResolveClass(ctx context.Context, c client.Reader, className string) (*LoggingSetupClass, error) {
+
+	if className != "" {
+		class := &LoggingSetupClass{}
+		err := c.Get(ctx, types.NamespacedName{Name: className}, class)
+		if errors.IsNotFound(err) {
+			return nil, &ClassNotFoundError{Name: className}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return class, nil
+	}
+
+	classes := &LoggingSetupClassList{}
+	if err := c.List(ctx, classes); err != nil {
+		return nil, err
+	}
+
+	for i := range classes.Items {
+		if classes.Items[i].IsDefault() {
+			return &classes.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// PolicyViolations returns the violations of all LoggingPolicies by the class, which may be nil for the built-in defaults.
+// template contains the settings of the IndexSet template of the class, it may be nil if it is unknown.
+func PolicyViolations(ctx context.Context, c client.Reader, class *LoggingSetupClass, template *IndexSetTemplateSettings) ([]string, error) {
+
+	policies := &LoggingPolicyList{}
+	if err := c.List(ctx, policies); err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	for i := range policies.Items {
+		violations = append(violations, policies.Items[i].Violations(class, template)...)
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ANNOTATION_DEFAULT_CLASS marks the LoggingSetupClass used for LoggingSetups without a className
+	ANNOTATION_DEFAULT_CLASS = "logging.world-direct.at/is-default-class"
+
+	DEFAULT_INDEXSET_TEMPLATE = "wd-logging-operator-template"
+	DEFAULT_RULE_FIELD_NAME   = "kubernetes_namespace_name"
+)
+
+// DEFAULT_ROLES are the Graylog roles of the user, if the class doesn't define them
+var DEFAULT_ROLES = []string{"Reader", "Dashboard Creator"}
+
+// LoggingSetupClassSpec defines a reusable profile for LoggingSetups
+type LoggingSetupClassSpec struct {
+
+	// IndexSetTemplate is the title of the Graylog IndexSet used as template for new IndexSets.
+	// Defaults to 'wd-logging-operator-template'
+	// +optional
+	IndexSetTemplate string `json:"indexSetTemplate,omitempty"`
+
+	// RetentionDays overrides the rotation and retention of the template:
+	// the IndexSet is rotated daily, and indices older than this number of days are deleted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RetentionDays *int32 `json:"retentionDays,omitempty"`
+
+	// Shards overrides the number of shards of the template
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Shards *int32 `json:"shards,omitempty"`
+
+	// Replicas overrides the number of replicas of the template
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Roles are the Graylog roles of the user. Defaults to 'Reader' and 'Dashboard Creator'
+	// +optional
+	Roles []string `json:"roles,omitempty"`
+
+	// Stream contains the options of the Graylog stream
+	// +optional
+	Stream StreamClassSpec `json:"stream,omitempty"`
+}
+
+// StreamClassSpec contains the options of the Graylog stream
+type StreamClassSpec struct {
+
+	// RuleFieldName is the log field matched against the Namespace.
+	// Defaults to 'kubernetes_namespace_name'
+	// +optional
+	RuleFieldName string `json:"ruleFieldName,omitempty"`
+
+	// RemoveMatchesFromDefaultStream removes the messages of the stream from the 'All messages' stream.
+	// Defaults to true
+	// +optional
+	RemoveMatchesFromDefaultStream *bool `json:"removeMatchesFromDefaultStream,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// LoggingSetupClass is the Schema for the loggingsetupclasses API
+type LoggingSetupClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LoggingSetupClassSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LoggingSetupClassList contains a list of LoggingSetupClass
+type LoggingSetupClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LoggingSetupClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LoggingSetupClass{}, &LoggingSetupClassList{})
+}
+
+// IsDefault returns true if the class is annotated as default class
+func (class *LoggingSetupClass) IsDefault() bool {
+	return class.Annotations[ANNOTATION_DEFAULT_CLASS] == "true"
+}
+
+// EffectiveIndexSetTemplate returns the IndexSetTemplate, or the default
+func (spec *LoggingSetupClassSpec) EffectiveIndexSetTemplate() string {
+	if spec.IndexSetTemplate == "" {
+		return DEFAULT_INDEXSET_TEMPLATE
+	}
+	return spec.IndexSetTemplate
+}
+
+// EffectiveRoles returns the Roles, or the defaults
+func (spec *LoggingSetupClassSpec) EffectiveRoles() []string {
+	if len(spec.Roles) == 0 {
+		return DEFAULT_ROLES
+	}
+	return spec.Roles
+}
+
+// EffectiveRuleFieldName returns the RuleFieldName, or the default
+func (spec *StreamClassSpec) EffectiveRuleFieldName() string {
+	if spec.RuleFieldName == "" {
+		return DEFAULT_RULE_FIELD_NAME
+	}
+	return spec.RuleFieldName
+}
+
+// EffectiveRemoveMatchesFromDefaultStream returns RemoveMatchesFromDefaultStream, or the default
+func (spec *StreamClassSpec) EffectiveRemoveMatchesFromDefaultStream() bool {
+	if spec.RemoveMatchesFromDefaultStream == nil {
+		return true
+	}
+	return *spec.RemoveMatchesFromDefaultStream
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var loggingsetupclasslog = logf.Log.WithName("loggingsetupclass-resource")
+
+func (r *LoggingSetupClass) SetupWebhookWithManager(mgr ctrl.Manager, templates TemplateResolver) error {
+	webhookClient = mgr.GetClient()
+	webhookTemplates = templates
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-logging-world-direct-at-v1alpha1-loggingsetupclass,mutating=false,failurePolicy=fail,sideEffects=None,groups=logging.world-direct.at,resources=loggingsetupclasses,verbs=create;update,versions=v1alpha1,name=vloggingsetupclass.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &LoggingSetupClass{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *LoggingSetupClass) ValidateCreate() error {
+	loggingsetupclasslog.Info("validate create", "name", r.Name)
+
+	return r.validatePolicies()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
+// Only changes of the spec are validated, like for LoggingSetups.
+func (r *LoggingSetupClass) ValidateUpdate(old runtime.Object) error {
+	loggingsetupclasslog.Info("validate update", "name", r.Name)
+
+	if oldObj, ok := old.(*LoggingSetupClass); ok && equality.Semantic.DeepEqual(oldObj.Spec, r.Spec) {
+		return nil
+	}
+
+	return r.validatePolicies()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *LoggingSetupClass) ValidateDelete() error {
+	return nil
+}
+
+func (r *LoggingSetupClass) validatePolicies() error {
+
+	ctx := context.Background()
+
+	violations, err := PolicyViolations(ctx, webhookClient, r, resolveTemplate(ctx, r))
+	if err != nil {
+		return err
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("LoggingSetupClass violates LoggingPolicies: %s", strings.Join(violations, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+func status(ctx context.Context, cmd *command) error {
+
+	obj, err := cmd.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "LoggingSetup:\t%s/%s\n", obj.Namespace, obj.Name)
+	fmt.Fprintf(w, "User:\t%s\t%s\n", obj.Status.UserName, obj.Status.GraylogStatus.UserID)
+	fmt.Fprintf(w, "IndexSet:\t\t%s\n", obj.Status.GraylogStatus.IndexSetID)
+	fmt.Fprintf(w, "Stream:\t\t%s\n", obj.Status.GraylogStatus.StreamID)
+	if obj.Status.LastPasswordRotation != nil {
+		fmt.Fprintf(w, "Password changed:\t%s\n", obj.Status.LastPasswordRotation.Format(time.RFC3339))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "CONDITION\tSTATUS\tREASON\tSINCE\tMESSAGE")
+	for _, condition := range obj.Status.Conditions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", condition.Type, condition.Status, condition.Reason,
+			condition.LastTransitionTime.Format(time.RFC3339), condition.Message)
+	}
+
+	return w.Flush()
+}
+
+func open(ctx context.Context, cmd *command) error {
+
+	obj, err := cmd.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.graylogURL == "" {
+		return fmt.Errorf("the Graylog URL is unknown, please set --graylog-url or GRAYLOG_URL")
+	}
+
+	if obj.Status.GraylogStatus.StreamID == "" {
+		return fmt.Errorf("the stream of %s/%s is not provisioned yet", obj.Namespace, obj.Name)
+	}
+
+	fmt.Printf("Search:   %s/streams/%s/search\n", cmd.graylogURL, obj.Status.GraylogStatus.StreamID)
+	if obj.Status.GraylogStatus.IndexSetID != "" {
+		fmt.Printf("IndexSet: %s/system/index_sets/%s\n", cmd.graylogURL, obj.Status.GraylogStatus.IndexSetID)
+	}
+
+	return nil
+}
+
+func resetPassword(ctx context.Context, cmd *command) error {
+
+	obj, err := cmd.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(obj.DeepCopy())
+	if obj.Annotations == nil {
+		obj.Annotations = make(map[string]string)
+	}
+	obj.Annotations[v1alpha1.ANNOTATION_RESET_PASSWORD] = time.Now().UTC().Format(time.RFC3339)
+
+	if err := cmd.client.Patch(ctx, obj, patch); err != nil {
+		return err
+	}
+
+	fmt.Printf("Password reset requested, the new password will be written to the Secret %s/%s\n",
+		obj.Namespace, obj.CredentialsSecretName())
+	return nil
+}
+
+func showUsage(ctx context.Context, cmd *command) error {
+
+	obj, err := cmd.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	usage := obj.Status.Usage
+	if usage == nil {
+		return fmt.Errorf("no usage reported for %s/%s yet", obj.Namespace, obj.Name)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Throughput:\t%d msg/s\n", usage.Throughput)
+	fmt.Fprintf(w, "Documents:\t%d\n", usage.Documents)
+	fmt.Fprintf(w, "Indices:\t%d\n", usage.Indices)
+	fmt.Fprintf(w, "Size:\t%.1f MiB\n", float64(usage.SizeBytes)/(1024*1024))
+	if usage.OldestMessage != nil {
+		fmt.Fprintf(w, "Oldest message:\t%s\n", usage.OldestMessage.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "Updated:\t%s\n", usage.LastUpdated.Format(time.RFC3339))
+
+	return w.Flush()
+}
+
+func doctor(ctx context.Context, cmd *command) error {
+
+	obj, err := cmd.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	data := &graylog.GraylogProvisioningData{
+		Name:     obj.Namespace,
+		OwnerUID: string(obj.UID),
+	}
+	data.User.ID = obj.Status.GraylogStatus.UserID
+	data.IndexSet.ID = obj.Status.GraylogStatus.IndexSetID
+	data.Stream.ID = obj.Status.GraylogStatus.StreamID
+
+	config, err := graylog.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	api, err := graylog.NewClient(config, logr.Discard())
+	if err != nil {
+		return err
+	}
+
+	checks, err := graylog.CheckObjects(ctx, api, logr.Discard(), data)
+	if err != nil {
+		return err
+	}
+
+	problems := 3 - len(checks)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tID\tEXISTS\tOWNED\tMARKER")
+	for _, check := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%s\n", check.Kind, check.ID, check.Exists, check.Owned, check.Marker)
+		if !check.Exists || !check.Owned {
+			problems++
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found, missing IDs are not provisioned yet", problems)
+	}
+
+	fmt.Println("No problems found")
+	return nil
+}
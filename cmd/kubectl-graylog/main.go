@@ -0,0 +1,182 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-graylog is a kubectl plugin to inspect and operate LoggingSetups.
+// Install it by placing the binary in the PATH, and call it by `kubectl graylog <command>`.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loggingv1alpha1 "github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+)
+
+const usage = `kubectl graylog <command> [name] [flags]
+
+Commands:
+  status          Print the conditions and Graylog IDs of the LoggingSetup
+  open            Print deep links to the tenant's stream search in Graylog
+  reset-password  Request a new password for the Graylog user, written to the credentials Secret
+  usage           Print the throughput and index set usage
+  doctor          Cross-check the Graylog IDs in the status against the Graylog API
+
+The name of the LoggingSetup can be omitted if there is exactly one in the namespace.
+The doctor command connects to Graylog like the operator, configured by environment variables:
+  GRAYLOG_URL                   The URL of Graylog
+  GRAYLOG_AUTH_MODE             basic (the default), token or session
+  GRAYLOG_USER                  The user for the basic and session modes
+  GRAYLOG_PASSWORD              The password for the basic and session modes
+  GRAYLOG_TOKEN                 The access token for the token mode
+  GRAYLOG_CA_FILE               Optional CA bundle to verify the server certificate
+  GRAYLOG_CLIENT_CERT_FILE      Optional client certificate
+  GRAYLOG_CLIENT_KEY_FILE       The key of the client certificate
+  GRAYLOG_TLS_SERVER_NAME       Optional server name to verify instead of the host of the URL
+  GRAYLOG_TLS_INSECURE          Skip the verification of the server certificate, if "true"
+
+Flags:
+`
+
+// command is the context passed to all commands
+type command struct {
+	client     client.Client
+	namespace  string
+	name       string
+	graylogURL string
+}
+
+var commands = map[string]func(ctx context.Context, cmd *command) error{
+	"status":         status,
+	"open":           open,
+	"reset-password": resetPassword,
+	"usage":          showUsage,
+	"doctor":         doctor,
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+
+	var kubeconfig, namespace, graylogURL string
+
+	fs := flag.NewFlagSet("kubectl-graylog", flag.ContinueOnError)
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+	fs.StringVar(&namespace, "namespace", "", "The namespace of the LoggingSetup, defaults to the namespace of the current context.")
+	fs.StringVar(&namespace, "n", "", "Shorthand for --namespace.")
+	fs.StringVar(&graylogURL, "graylog-url", os.Getenv("GRAYLOG_URL"), "The URL of Graylog for deep links.")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+
+	// allow flags before and after the positional arguments
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if fs.NArg() == 0 {
+			break
+		}
+
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(positional) == 0 || len(positional) > 2 {
+		fs.Usage()
+		return fmt.Errorf("expected a command and an optional name")
+	}
+
+	run, ok := commands[positional[0]]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command '%s'", positional[0])
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	if namespace == "" {
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return err
+		}
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(loggingv1alpha1.AddToScheme(scheme))
+
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+
+	cmd := &command{
+		client:     c,
+		namespace:  namespace,
+		graylogURL: strings.TrimSuffix(graylogURL, "/"),
+	}
+
+	if len(positional) == 2 {
+		cmd.name = positional[1]
+	}
+
+	return run(context.Background(), cmd)
+}
+
+// get returns the LoggingSetup by name, or the only one in the namespace if no name is given
+func (cmd *command) get(ctx context.Context) (*loggingv1alpha1.LoggingSetup, error) {
+
+	if cmd.name != "" {
+		obj := &loggingv1alpha1.LoggingSetup{}
+		err := cmd.client.Get(ctx, client.ObjectKey{Namespace: cmd.namespace, Name: cmd.name}, obj)
+		return obj, err
+	}
+
+	list := &loggingv1alpha1.LoggingSetupList{}
+	if err := cmd.client.List(ctx, list, client.InNamespace(cmd.namespace)); err != nil {
+		return nil, err
+	}
+
+	switch len(list.Items) {
+	case 0:
+		return nil, fmt.Errorf("no LoggingSetup found in namespace '%s'", cmd.namespace)
+	case 1:
+		return &list.Items[0], nil
+	default:
+		return nil, fmt.Errorf("%d LoggingSetups found in namespace '%s', please specify the name", len(list.Items), cmd.namespace)
+	}
+}
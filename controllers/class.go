@@ -0,0 +1,75 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+//+kubebuilder:rbac:groups=logging.world-direct.at,resources=loggingsetupclasses,verbs=get;list;watch
+
+// applyClass sets the options of the class to data, class may be nil for the built-in defaults
+func applyClass(data *graylog.GraylogProvisioningData, class *v1alpha1.LoggingSetupClass) {
+
+	spec := v1alpha1.LoggingSetupClassSpec{}
+	if class != nil {
+		spec = class.Spec
+	}
+
+	data.User.Roles = spec.EffectiveRoles()
+
+	data.IndexSet.TemplateName = spec.EffectiveIndexSetTemplate()
+	data.IndexSet.RetentionDays = spec.RetentionDays
+	data.IndexSet.Shards = spec.Shards
+	data.IndexSet.Replicas = spec.Replicas
+
+	data.Stream.RuleFieldName = spec.Stream.EffectiveRuleFieldName()
+	data.Stream.RemoveMatchesFromDefaultStream = spec.Stream.EffectiveRemoveMatchesFromDefaultStream()
+}
+
+// loggingSetupsForClass maps a LoggingSetupClass to the LoggingSetups using it
+func (r *LoggingSetupReconciler) loggingSetupsForClass(o client.Object) []reconcile.Request {
+
+	class, ok := o.(*v1alpha1.LoggingSetupClass)
+	if !ok {
+		return nil
+	}
+
+	list := &v1alpha1.LoggingSetupList{}
+	if err := r.List(context.Background(), list); err != nil {
+		r.Log.Error(err, "Failed to list LoggingSetups for class", "class", class.Name)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, obj := range list.Items {
+		if obj.Spec.ClassName == class.Name || (obj.Spec.ClassName == "" && class.IsDefault()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name},
+			})
+		}
+	}
+
+	return requests
+}
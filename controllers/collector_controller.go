@@ -0,0 +1,144 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	loggingv1alpha1 "github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	"github.com/world-direct/wd-k8s-operator/provisioners/collector"
+)
+
+// CollectorConfigReconciler renders the configuration of the log collector into a single ConfigMap,
+// routing the logs of every Namespace with a LoggingSetup to Graylog
+type CollectorConfigReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+
+	// ConfigMap is the name and namespace of the rendered ConfigMap
+	ConfigMap types.NamespacedName
+
+	// Config contains the settings of the collector, the routes are filled from the LoggingSetups
+	Config collector.Config
+}
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch
+
+func (r *CollectorConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("configmap", r.ConfigMap)
+
+	list := &loggingv1alpha1.LoggingSetupList{}
+	if err := r.List(ctx, list); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	config := r.Config
+	config.Routes = nil
+
+	for _, obj := range list.Items {
+		if obj.DeletionTimestamp != nil {
+			continue
+		}
+
+		class, err := loggingv1alpha1.ResolveClass(ctx, r.Client, obj.Spec.ClassName)
+		if err != nil {
+			// not provisioned either, the LoggingSetupReconciler reports it
+			log.V(1).Info("Skipping LoggingSetup without class", "loggingsetup", obj.Namespace+"/"+obj.Name, "error", err.Error())
+			continue
+		}
+
+		spec := loggingv1alpha1.LoggingSetupClassSpec{}
+		if class != nil {
+			spec = class.Spec
+		}
+
+		config.Routes = append(config.Routes, collector.Route{
+			Namespace:     obj.Namespace,
+			RuleFieldName: spec.Stream.EffectiveRuleFieldName(),
+		})
+	}
+
+	data, err := collector.Render(&config)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.ConfigMap.Name,
+			Namespace: r.ConfigMap.Namespace,
+		},
+	}
+
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[LABEL_MANAGED_BY] = "wd-k8s-operator"
+		cm.Data = data
+		return nil
+	})
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if result != controllerutil.OperationResultNone {
+		log.Info("Collector configuration updated", "result", result, "routes", len(config.Routes))
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CollectorConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	// Render validates the type, so an invalid configuration fails at startup
+	if _, err := collector.Render(&r.Config); err != nil {
+		return err
+	}
+
+	isConfigMap := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == r.ConfigMap.Namespace && obj.GetName() == r.ConfigMap.Name
+	})
+
+	// every change of a LoggingSetup or class may change the routes
+	mapToConfigMap := handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: r.ConfigMap}}
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("collectorconfig").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(isConfigMap)).
+		Watches(&source.Kind{Type: &loggingv1alpha1.LoggingSetup{}}, mapToConfigMap).
+		Watches(&source.Kind{Type: &loggingv1alpha1.LoggingSetupClass{}}, mapToConfigMap).
+		Complete(r)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+// DEFAULT_HEALTH_INTERVAL is the default interval to check the health of the Graylog cluster
+const DEFAULT_HEALTH_INTERVAL = 30 * time.Second
+
+// GraylogHealth checks the health of the Graylog cluster periodically.
+// It is added to the manager as a Runnable, backs the readiness check, and is reported by the graylog_up metric.
+type GraylogHealth struct {
+	Graylog  graylog.GraylogAPI
+	Log      logr.Logger
+	Interval time.Duration
+
+	mu  sync.RWMutex
+	err error
+}
+
+// NewGraylogHealth returns a GraylogHealth reporting Graylog as unreachable until the first check
+func NewGraylogHealth(api graylog.GraylogAPI, log logr.Logger, interval time.Duration) *GraylogHealth {
+	if interval <= 0 {
+		interval = DEFAULT_HEALTH_INTERVAL
+	}
+
+	return &GraylogHealth{
+		Graylog:  api,
+		Log:      log,
+		Interval: interval,
+		err:      errors.New("Graylog has not been checked yet"),
+	}
+}
+
+// Start checks the health until ctx is done
+func (h *GraylogHealth) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, h.check, h.Interval)
+	return nil
+}
+
+// NeedLeaderElection returns false, because every replica reports its own readiness
+func (h *GraylogHealth) NeedLeaderElection() bool {
+	return false
+}
+
+func (h *GraylogHealth) check(ctx context.Context) {
+
+	err := graylog.CheckCluster(ctx, h.Graylog)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err != nil && h.err == nil {
+		h.Log.Error(err, "Graylog became unreachable")
+	} else if err == nil && h.err != nil {
+		h.Log.Info("Graylog is reachable")
+	}
+
+	h.err = err
+	recordGraylogUp(err == nil)
+}
+
+// Err returns the error of the last check, nil if Graylog is healthy
+func (h *GraylogHealth) Err() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.err
+}
+
+// Check implements healthz.Checker
+func (h *GraylogHealth) Check(_ *http.Request) error {
+	return h.Err()
+}
+
+// CONDIIONTYPE_GRAYLOG_UNREACHABLE is True while the provisioning is held back, because Graylog is not healthy
+const CONDIIONTYPE_GRAYLOG_UNREACHABLE = "GraylogUnreachable"
+
+// checkGraylogReachable updates the GraylogUnreachable condition and returns false if the provisioning must be held back.
+// The other conditions are kept, as they still describe the objects provisioned last.
+func (r *LoggingSetupReconciler) checkGraylogReachable(obj *v1alpha1.LoggingSetup) bool {
+
+	if r.Health == nil {
+		return true
+	}
+
+	if err := r.Health.Err(); err != nil {
+		meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+			Type:    CONDIIONTYPE_GRAYLOG_UNREACHABLE,
+			Status:  metav1.ConditionTrue,
+			Reason:  "HealthCheckFailed",
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+		Type:    CONDIIONTYPE_GRAYLOG_UNREACHABLE,
+		Status:  metav1.ConditionFalse,
+		Reason:  "Reachable",
+		Message: "The Graylog cluster is healthy",
+	})
+	return true
+}
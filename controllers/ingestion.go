@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+// INGESTION_CONFIGMAP_SUFFIX is appended to the name of the LoggingSetup for the ingestion ConfigMap
+const INGESTION_CONFIGMAP_SUFFIX = "-graylog-ingestion"
+
+// IngestionConfigMapName returns the name of the ConfigMap containing the GELF endpoints
+func IngestionConfigMapName(obj *v1alpha1.LoggingSetup) string {
+	return obj.Name + INGESTION_CONFIGMAP_SUFFIX
+}
+
+// updateIngestion publishes the GELF inputs of Graylog and the fields expected by the Stream rules
+// into the status and a ConfigMap, so that applications can send their logs directly
+func (r *LoggingSetupReconciler) updateIngestion(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, data *graylog.GraylogProvisioningData) {
+
+	if !meta.IsStatusConditionTrue(obj.Status.Conditions, CONDIIONTYPE_STREAM) {
+		return
+	}
+
+	inputs, err := graylog.GetGelfInputs(ctx, r.Graylog, log)
+	if err != nil {
+		// informational only, so the previous values are kept
+		log.Error(err, "Failed to read GELF inputs")
+		return
+	}
+
+	ingestion := &v1alpha1.IngestionStatus{
+		Fields: map[string]string{
+			data.Stream.RuleFieldName: data.Name,
+		},
+		ConfigMapName: IngestionConfigMapName(obj),
+	}
+
+	if data.Stream.ClusterFieldName != "" && data.Stream.ClusterName != "" {
+		ingestion.Fields[data.Stream.ClusterFieldName] = data.Stream.ClusterName
+	}
+
+	for _, input := range inputs {
+		endpoint := v1alpha1.IngestionEndpoint{
+			Title:    input.Title,
+			Host:     input.Host,
+			Port:     input.Port,
+			Protocol: input.Protocol,
+			TLS:      input.TLS,
+		}
+
+		if r.IngestionHost != "" {
+			endpoint.Host = r.IngestionHost
+		}
+
+		ingestion.Endpoints = append(ingestion.Endpoints, endpoint)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ingestion.ConfigMapName,
+			Namespace: obj.Namespace,
+		},
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Data = ingestionConfigMapData(ingestion)
+		return controllerutil.SetControllerReference(obj, cm, r.Scheme)
+	})
+	if err != nil {
+		log.Error(err, "Failed to write ingestion ConfigMap")
+		return
+	}
+
+	obj.Status.Ingestion = ingestion
+}
+
+// ingestionConfigMapData returns the data of the ingestion ConfigMap, usable as environment variables.
+// If Graylog has several inputs with the same protocol, the first one is used.
+func ingestionConfigMapData(ingestion *v1alpha1.IngestionStatus) map[string]string {
+
+	data := map[string]string{}
+
+	for _, endpoint := range ingestion.Endpoints {
+		prefix := "GELF_" + strings.ToUpper(endpoint.Protocol) + "_"
+		if _, exists := data[prefix+"HOST"]; exists {
+			continue
+		}
+
+		data[prefix+"HOST"] = endpoint.Host
+		data[prefix+"PORT"] = fmt.Sprint(endpoint.Port)
+		data[prefix+"TLS"] = fmt.Sprint(endpoint.TLS)
+	}
+
+	// key=value pairs, sorted for a stable ConfigMap
+	fields := make([]string, 0, len(ingestion.Fields))
+	for name, value := range ingestion.Fields {
+		fields = append(fields, name+"="+value)
+	}
+	sort.Strings(fields)
+	data["GELF_ADDITIONAL_FIELDS"] = strings.Join(fields, ",")
+
+	return data
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+)
+
+func TestIngestionConfigMapData(t *testing.T) {
+
+	udp := v1alpha1.IngestionEndpoint{Title: "GELF UDP", Host: "graylog", Port: 12201, Protocol: "udp"}
+	tcp := v1alpha1.IngestionEndpoint{Title: "GELF TCP", Host: "graylog", Port: 12202, Protocol: "tcp", TLS: true}
+	otherUDP := v1alpha1.IngestionEndpoint{Title: "GELF UDP 2", Host: "graylog", Port: 12203, Protocol: "udp"}
+
+	tests := []struct {
+		name      string
+		ingestion *v1alpha1.IngestionStatus
+		expected  map[string]string
+	}{
+		{"empty", &v1alpha1.IngestionStatus{}, map[string]string{
+			"GELF_ADDITIONAL_FIELDS": "",
+		}},
+		{"endpoints and fields", &v1alpha1.IngestionStatus{
+			Endpoints: []v1alpha1.IngestionEndpoint{udp, tcp},
+			Fields:    map[string]string{"kubernetes_namespace_name": "tenant", "cluster": "prod"},
+		}, map[string]string{
+			"GELF_UDP_HOST":          "graylog",
+			"GELF_UDP_PORT":          "12201",
+			"GELF_UDP_TLS":           "false",
+			"GELF_TCP_HOST":          "graylog",
+			"GELF_TCP_PORT":          "12202",
+			"GELF_TCP_TLS":           "true",
+			"GELF_ADDITIONAL_FIELDS": "cluster=prod,kubernetes_namespace_name=tenant",
+		}},
+		{"first endpoint of a protocol", &v1alpha1.IngestionStatus{
+			Endpoints: []v1alpha1.IngestionEndpoint{udp, otherUDP},
+		}, map[string]string{
+			"GELF_UDP_HOST":          "graylog",
+			"GELF_UDP_PORT":          "12201",
+			"GELF_UDP_TLS":           "false",
+			"GELF_ADDITIONAL_FIELDS": "",
+		}},
+	}
+
+	for _, test := range tests {
+		if data := ingestionConfigMapData(test.ingestion); !reflect.DeepEqual(data, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, data)
+		}
+	}
+}
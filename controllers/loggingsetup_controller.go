@@ -18,28 +18,89 @@ package controllers
 
 import (
 	"context"
+	goerrors "errors"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
 	loggingv1alpha1 "github.com/world-direct/wd-k8s-operator/api/v1alpha1"
 	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 // LoggingSetupReconciler reconciles a LoggingSetup object
 type LoggingSetupReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Graylog is the API used for provisioning, created from the environment if nil
+	Graylog graylog.GraylogAPI
+
+	// Health holds back the provisioning while Graylog is unreachable, it is not checked if nil
+	Health *GraylogHealth
+
+	// Naming renders the names of the Graylog objects, defaults are used if nil
+	Naming *graylog.Naming
+
+	// ClusterFieldName is the log field matched against the cluster name of Naming.
+	// If set, every stream gets an additional rule to only match logs of this cluster.
+	ClusterFieldName string
+
+	// ReportDriftOnly disables the correction of drift in Graylog, it is only reported by events
+	ReportDriftOnly bool
+
+	// ResyncInterval is the interval to reconcile every LoggingSetup again, to notice changes in Graylog.
+	// It can be overridden per object by the ANNOTATION_RESYNC_INTERVAL annotation, 0 disables the resync.
+	ResyncInterval time.Duration
+
+	// ResyncJitter is the maximum factor of the ResyncInterval added randomly, to spread the resyncs, 0 disables it
+	ResyncJitter float64
+
+	// UsageInterval is the interval to read the usage from Graylog into the status, independent of the resync.
+	// 0 disables it
+	UsageInterval time.Duration
+
+	// indexRanges keeps the index ranges of all indices for one UsageInterval
+	indexRanges indexRangesCache
+
+	// IngestionHost overrides the host of the GELF inputs published to the LoggingSetups,
+	// e.g. if Graylog is exposed by a load balancer
+	IngestionHost string
+
+	// ProbeAddress is the host:port of the GELF UDP input the delivery probe messages are sent to
+	ProbeAddress string
+
+	// ProbeInterval is the interval to send a delivery probe message for every LoggingSetup, 0 disables it
+	ProbeInterval time.Duration
+
+	// ProbeTimeout is the time a probe message must arrive in the Stream within
+	ProbeTimeout time.Duration
+
+	// RequeueBaseDelay and RequeueMaxDelay limit the exponential backoff of failed reconciles,
+	// the defaults of controller-runtime are used if not set
+	RequeueBaseDelay time.Duration
+	RequeueMaxDelay  time.Duration
 }
 
 const (
@@ -47,12 +108,19 @@ const (
 	CONDIIONTYPE_INDEXSET = "IndexSetProvisioned"
 	CONDIIONTYPE_STREAM   = "StreamProvisioned"
 
+	// set if the finalizer refuses to delete Graylog objects not owned by the LoggingSetup
+	CONDIIONTYPE_DELETION_BLOCKED = "DeletionBlocked"
+
 	FINALIZER = "logging.world-direct.at/finalizer"
+
+	// ANNOTATION_RESYNC_INTERVAL overrides the ResyncInterval for an object, e.g. "2m"
+	ANNOTATION_RESYNC_INTERVAL = "logging.world-direct.at/resync-interval"
 )
 
 //+kubebuilder:rbac:groups=logging.world-direct.at,resources=loggingsetups,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=logging.world-direct.at,resources=loggingsetups/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=logging.world-direct.at,resources=loggingsetups/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -94,7 +162,18 @@ func (r *LoggingSetupReconciler) Reconcile(ctx context.Context, req ctrl.Request
 			// Run finalization logic for memcachedFinalizer. If the
 			// finalization logic fails, don't remove the finalizer so
 			// that we can retry during the next reconciliation.
-			if err := r.finalizeLoggingSetup(ctx, log, obj); err != nil {
+			start := time.Now()
+			err = r.finalizeLoggingSetup(ctx, log, obj)
+			recordFinalizerDuration(start, err)
+			if err != nil {
+				if updateErr := r.Status().Update(ctx, obj); updateErr != nil {
+					log.Error(updateErr, "Failed to update Status")
+				}
+
+				// the DeletionBlocked condition tells that it must be resolved manually, so it isn't retried with backoff
+				if isPermanent(err) {
+					return ctrl.Result{RequeueAfter: r.resyncAfter(log, obj)}, nil
+				}
 				return ctrl.Result{}, err
 			}
 
@@ -130,7 +209,25 @@ func (r *LoggingSetupReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		}
 	}
 
-	r.provisionLoggingSetup(ctx, log, obj)
+	// don't fail every object during a maintenance of Graylog, but wait until it is back
+	if !r.checkGraylogReachable(obj) {
+		log.Info("Graylog is unreachable, provisioning held back")
+		if updateErr := r.Status().Update(ctx, obj); updateErr != nil {
+			log.Error(updateErr, "Failed to update Status")
+		}
+		return ctrl.Result{RequeueAfter: r.Health.Interval}, nil
+	}
+
+	// while a probe message is pending or the usage is due, they are refreshed without provisioning all objects again
+	if now := time.Now(); r.onlyProbeDue(log, obj, now) || r.onlyUsageDue(log, obj, now) {
+		return r.refreshStatus(ctx, log, obj)
+	}
+
+	provisionErr := r.provisionLoggingSetup(ctx, log, obj)
+	if provisionErr == nil {
+		obj.Status.ObservedGeneration = obj.Generation
+		obj.Status.LastProvisioned = &metav1.Time{Time: time.Now()}
+	}
 
 	// Update the status
 	////////////////////////////
@@ -143,41 +240,215 @@ func (r *LoggingSetupReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		log.Info("Update performed, Reconciliation done", "resourceVersion", obj.ObjectMeta.ResourceVersion)
 	}
 
-	return ctrl.Result{}, err
+	// failed provisioning is requeued with the backoff of the controller, objects owned by others only with the resync
+	if provisionErr != nil && !isPermanent(provisionErr) {
+		return ctrl.Result{}, provisionErr
+	}
+
+	requeueAfter := r.resyncAfter(log, obj)
+	if probe := r.probeRequeueAfter(obj); probe > 0 && (requeueAfter == 0 || probe < requeueAfter) {
+		requeueAfter = probe
+	}
+	if usage := r.usageRequeueAfter(obj); usage > 0 && (requeueAfter == 0 || usage < requeueAfter) {
+		requeueAfter = usage
+	}
+	if rotation := passwordRotationAfter(obj, time.Now()); rotation > 0 && (requeueAfter == 0 || rotation < requeueAfter) {
+		requeueAfter = rotation
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func (r *LoggingSetupReconciler) provisionLoggingSetup(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup) {
+// provisioningUpToDate returns true if obj doesn't need to be provisioned again: the spec is unchanged since the last
+// successful provisioning, and neither the resync nor a password change is due
+func (r *LoggingSetupReconciler) provisioningUpToDate(log logr.Logger, obj *v1alpha1.LoggingSetup, now time.Time) bool {
+
+	if obj.Status.LastProvisioned == nil || obj.Status.ObservedGeneration != obj.Generation {
+		return false
+	}
+
+	if interval := r.resyncInterval(log, obj); interval > 0 && now.Sub(obj.Status.LastProvisioned.Time) >= interval {
+		return false
+	}
+
+	return passwordChangeReason(obj, now) == ""
+}
 
-	var err error
+// refreshStatus searches a pending probe message and reads the usage, without provisioning the Graylog objects.
+// obj is requeued until the next of them, the resync or the password rotation is due.
+func (r *LoggingSetupReconciler) refreshStatus(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup) (ctrl.Result, error) {
+
+	data := &graylog.GraylogProvisioningData{Name: obj.Namespace}
+	data.IndexSet.ID = obj.Status.GraylogStatus.IndexSetID
+	data.Stream.ID = obj.Status.GraylogStatus.StreamID
+
+	r.updateUsage(ctx, log, obj, data)
+	r.probeDelivery(ctx, log, obj, data)
+
+	if err := r.Status().Update(ctx, obj); err != nil {
+		log.Error(err, "Failed to update Status")
+	}
+
+	requeueAfter := r.probeRequeueAfter(obj)
+	if usage := r.usageRequeueAfter(obj); usage > 0 && (requeueAfter == 0 || usage < requeueAfter) {
+		requeueAfter = usage
+	}
+	if interval := r.resyncInterval(log, obj); interval > 0 {
+		resync := time.Until(obj.Status.LastProvisioned.Add(interval))
+		if resync < time.Second {
+			resync = time.Second
+		}
+		if requeueAfter == 0 || resync < requeueAfter {
+			requeueAfter = resync
+		}
+	}
+	if rotation := passwordRotationAfter(obj, time.Now()); rotation > 0 && (requeueAfter == 0 || rotation < requeueAfter) {
+		requeueAfter = rotation
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// resyncAfter returns the jittered delay until the next periodic resync of obj, 0 if disabled
+func (r *LoggingSetupReconciler) resyncAfter(log logr.Logger, obj *v1alpha1.LoggingSetup) time.Duration {
+
+	interval := r.resyncInterval(log, obj)
+	if interval <= 0 {
+		return 0
+	}
+
+	// wait.Jitter uses a factor of 1 for values <= 0, so no jitter must be handled here
+	if r.ResyncJitter <= 0 {
+		return interval
+	}
+
+	return wait.Jitter(interval, r.ResyncJitter)
+}
+
+// resyncInterval returns the interval of the periodic resync of obj, 0 if disabled
+func (r *LoggingSetupReconciler) resyncInterval(log logr.Logger, obj *v1alpha1.LoggingSetup) time.Duration {
+
+	interval := r.ResyncInterval
+	if value, ok := obj.Annotations[ANNOTATION_RESYNC_INTERVAL]; ok {
+		override, err := time.ParseDuration(value)
+		if err != nil {
+			log.Error(err, "Invalid resync interval annotation, using the default", "value", value)
+		} else {
+			interval = override
+		}
+	}
+
+	return interval
+}
+
+// provisionLoggingSetup provisions the Graylog objects and updates the status of obj.
+// Returns the errors which should be retried, errors of the spec are only reported in the conditions.
+func (r *LoggingSetupReconciler) provisionLoggingSetup(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup) error {
+
+	var (
+		err  error
+		errs []error
+	)
 
 	// collect data for provisioning
 	data := &graylog.GraylogProvisioningData{
-		Name: obj.Namespace,
+		Name:            obj.Namespace,
+		OwnerUID:        string(obj.UID),
+		ReportDriftOnly: r.ReportDriftOnly,
 	}
 
+	if err = r.Naming.Apply(data); err != nil {
+		log.Error(err, "Failed to render names")
+		setAllConditionsFalse(obj, "InvalidName", err)
+		return nil
+	}
+
+	class, err := v1alpha1.ResolveClass(ctx, r.Client, obj.Spec.ClassName)
+	if err != nil {
+		log.Error(err, "Failed to resolve LoggingSetupClass")
+
+		// a missing class is reconciled again by the watch when it is created
+		if goerrors.As(err, new(*v1alpha1.ClassNotFoundError)) {
+			setAllConditionsFalse(obj, "ClassNotFound", err)
+			return nil
+		}
+		setAllConditionsFalse(obj, "ClassError", err)
+		return err
+	}
+
+	if compliant, err := r.checkPolicies(ctx, log, obj, class); !compliant {
+		return err
+	}
+
+	applyClass(data, class)
+
+	obj.Status.ClassName = ""
+	if class != nil {
+		obj.Status.ClassName = class.Name
+	}
+
+	// the provisioning calls fail as well if the version can't be read, so the error is reported by them
+	if version, err := r.Graylog.ServerVersion(ctx); err == nil {
+		obj.Status.GraylogStatus.Version = version.Raw
+		recordGraylogVersion(version.Raw)
+	}
+
+	// without an initial password, the user is created with a random one, which is stored in the credentials Secret
 	data.User.InitialPassword = obj.Spec.InitialUserPassword
-	data.User.Roles = []string{"Reader", "Dashboard Creator"}
+	if data.User.InitialPassword == "" {
+		if data.User.InitialPassword, err = generatePassword(); err != nil {
+			return err
+		}
+	}
 	data.User.ID = obj.Status.GraylogStatus.UserID
+	data.User.AppliedRoles = obj.Status.GraylogStatus.UserRoles
 
-	data.IndexSet.TemplateName = "wd-logging-operator-template"
 	data.IndexSet.ID = obj.Status.GraylogStatus.IndexSetID
 
-	data.Stream.RuleFieldName = "kubernetes_namespace_name"
+	data.Stream.ClusterFieldName = r.ClusterFieldName
+	data.Stream.ClusterName = r.Naming.Cluster
 	data.Stream.ID = obj.Status.GraylogStatus.StreamID
 
+	// adopt existing objects by ID, as long as no object is known in the status
+	if adopt := obj.Spec.Adopt; adopt != nil {
+		if data.User.ID == "" && adopt.UserID != "" {
+			data.User.ID = adopt.UserID
+			data.User.Adopt = true
+		}
+
+		if data.IndexSet.ID == "" && adopt.IndexSetID != "" {
+			data.IndexSet.ID = adopt.IndexSetID
+			data.IndexSet.Adopt = true
+		}
+
+		if data.Stream.ID == "" && adopt.StreamID != "" {
+			data.Stream.ID = adopt.StreamID
+			data.Stream.Adopt = true
+		}
+	}
+
 	if true || !meta.IsStatusConditionTrue(obj.Status.Conditions, CONDIIONTYPE_USER) {
 
-		err = graylog.ProvisionUser(ctx, r.Log, data)
+		err = graylog.ProvisionUser(ctx, r.Graylog, r.Log, data)
+		recordProvisioningResult("user", err)
+
+		// a created user is stored even if reading it back failed, its generated password would be lost otherwise
+		if storeErr := r.storeGeneratedPassword(ctx, log, obj, data); storeErr != nil {
+			log.Error(storeErr, "Failed to store the generated password")
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, "PasswordStoreFailed", "Generated password of user %s not stored, request a reset by the %s annotation: %s", data.User.Name, v1alpha1.ANNOTATION_RESET_PASSWORD, storeErr)
+		}
 
 		if err != nil {
-			meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
-				Type:    CONDIIONTYPE_USER,
-				Status:  metav1.ConditionFalse,
-				Reason:  "Failed",
-				Message: err.Error(),
-			})
+			meta.SetStatusCondition(&obj.Status.Conditions, provisioningFailedCondition(CONDIIONTYPE_USER, err))
+
+			// the next objects must not reference an object of someone else
+			if graylog.IsNotOwned(err) {
+				data.User.ID = ""
+			}
 
 			log.Error(err, "Failed to provision User")
+			errs = append(errs, err)
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, "UserFailed", "Failed to provision User: %s", err)
 
 		} else {
 			meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
@@ -187,22 +458,39 @@ func (r *LoggingSetupReconciler) provisionLoggingSetup(ctx context.Context, log
 			})
 
 			obj.Status.GraylogStatus.UserID = data.User.ID
+			obj.Status.GraylogStatus.UserRoles = data.User.AppliedRoles
+			obj.Status.UserName = data.User.Name
+			r.recordProvisioning(obj, "User", data.User.ID, data.User.Result)
+			r.recordDrift(obj, "User", data.User.ID, data.User.Drift)
+
+			if err := r.changePassword(ctx, log, obj, data); err != nil {
+				log.Error(err, "Failed to change password")
+				r.Recorder.Eventf(obj, corev1.EventTypeWarning, "PasswordChangeFailed", "Password of user %s not changed: %s", data.User.Name, err)
+			}
+
+			if err := r.reconcileTokens(ctx, log, obj, data); err != nil {
+				log.Error(err, "Failed to reconcile tokens")
+				r.Recorder.Eventf(obj, corev1.EventTypeWarning, "TokensFailed", "Tokens of user %s not reconciled: %s", data.User.Name, err)
+			}
 		}
 	}
 
 	if true || !meta.IsStatusConditionTrue(obj.Status.Conditions, CONDIIONTYPE_INDEXSET) {
 
-		err = graylog.ProvisionIndexSet(ctx, r.Log, data)
+		err = graylog.ProvisionIndexSet(ctx, r.Graylog, r.Log, data)
+		recordProvisioningResult("indexset", err)
 
 		if err != nil {
-			meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
-				Type:    CONDIIONTYPE_INDEXSET,
-				Status:  metav1.ConditionFalse,
-				Reason:  "Failed",
-				Message: err.Error(),
-			})
+			meta.SetStatusCondition(&obj.Status.Conditions, provisioningFailedCondition(CONDIIONTYPE_INDEXSET, err))
+
+			// the next objects must not reference an object of someone else
+			if graylog.IsNotOwned(err) {
+				data.IndexSet.ID = ""
+			}
 
 			log.Error(err, "Failed to provision IndexSet")
+			errs = append(errs, err)
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, "IndexSetFailed", "Failed to provision IndexSet: %s", err)
 
 		} else {
 			meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
@@ -212,23 +500,22 @@ func (r *LoggingSetupReconciler) provisionLoggingSetup(ctx context.Context, log
 			})
 
 			obj.Status.GraylogStatus.IndexSetID = data.IndexSet.ID
-
+			r.recordProvisioning(obj, "IndexSet", data.IndexSet.ID, data.IndexSet.Result)
+			r.recordDrift(obj, "IndexSet", data.IndexSet.ID, data.IndexSet.Drift)
 		}
 	}
 
 	if true || !meta.IsStatusConditionTrue(obj.Status.Conditions, CONDIIONTYPE_STREAM) {
 
-		err = graylog.ProvisionStream(ctx, r.Log, data)
+		err = graylog.ProvisionStream(ctx, r.Graylog, r.Log, data)
+		recordProvisioningResult("stream", err)
 
 		if err != nil {
-			meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
-				Type:    CONDIIONTYPE_STREAM,
-				Status:  metav1.ConditionFalse,
-				Reason:  "Failed",
-				Message: err.Error(),
-			})
+			meta.SetStatusCondition(&obj.Status.Conditions, provisioningFailedCondition(CONDIIONTYPE_STREAM, err))
 
 			log.Error(err, "Failed to provision Stream")
+			errs = append(errs, err)
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, "StreamFailed", "Failed to provision Stream: %s", err)
 
 		} else {
 			meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
@@ -238,56 +525,226 @@ func (r *LoggingSetupReconciler) provisionLoggingSetup(ctx context.Context, log
 			})
 
 			obj.Status.GraylogStatus.StreamID = data.Stream.ID
+			r.recordProvisioning(obj, "Stream", data.Stream.ID, data.Stream.Result)
+			r.recordDrift(obj, "Stream", data.Stream.ID, data.Stream.Drift)
+
+			if data.Stream.Shared {
+				r.Recorder.Eventf(obj, corev1.EventTypeNormal, "StreamShared", "Stream %s shared with user %s", data.Stream.ID, data.User.ID)
+			}
 		}
 	}
 
+	r.updateUsage(ctx, log, obj, data)
+	r.updateIngestion(ctx, log, obj, data)
+	r.probeDelivery(ctx, log, obj, data)
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// isPermanent returns true if retrying can't fix err, because all failed objects are owned by someone else.
+// Such errors are reported by the conditions and only checked again with the resync.
+func isPermanent(err error) bool {
+	if aggregate, ok := err.(utilerrors.Aggregate); ok {
+		for _, e := range aggregate.Errors() {
+			if !graylog.IsNotOwned(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return graylog.IsNotOwned(err)
+}
+
+// setAllConditionsFalse sets all provisioning conditions to False, if provisioning can't even start
+func setAllConditionsFalse(obj *v1alpha1.LoggingSetup, reason string, err error) {
+	for _, conditionType := range []string{CONDIIONTYPE_USER, CONDIIONTYPE_INDEXSET, CONDIIONTYPE_STREAM} {
+		meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+			Type:    conditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: err.Error(),
+		})
+	}
+}
+
+// provisioningFailedCondition returns the condition of a failed provisioning.
+// It is Unknown if Graylog hasn't been called because the circuit breaker is open, as the object may be fine.
+func provisioningFailedCondition(conditionType string, err error) metav1.Condition {
+	if graylog.IsNotOwned(err) {
+		return metav1.Condition{
+			Type:    conditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotOwned",
+			Message: err.Error(),
+		}
+	}
+
+	if graylog.IsCircuitOpen(err) {
+		return metav1.Condition{
+			Type:    conditionType,
+			Status:  metav1.ConditionUnknown,
+			Reason:  "CircuitOpen",
+			Message: err.Error(),
+		}
+	}
+
+	return metav1.Condition{
+		Type:    conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  "Failed",
+		Message: err.Error(),
+	}
+}
+
+// recordProvisioning emits an event for a created or adopted Graylog object
+func (r *LoggingSetupReconciler) recordProvisioning(obj *v1alpha1.LoggingSetup, kind, id string, result graylog.ProvisionResult) {
+	if result == graylog.RESULT_EXISTING {
+		return
+	}
+
+	r.Recorder.Eventf(obj, corev1.EventTypeNormal, kind+string(result), "%s %s %s", kind, id, strings.ToLower(string(result)))
+}
+
+// recordDrift emits an event listing the fields of a Graylog object differing from the desired state
+func (r *LoggingSetupReconciler) recordDrift(obj *v1alpha1.LoggingSetup, kind, id string, drift []string) {
+	if len(drift) == 0 {
+		return
+	}
+
+	if r.ReportDriftOnly {
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, "DriftDetected", "%s %s differs in: %s", kind, id, strings.Join(drift, ", "))
+	} else {
+		r.Recorder.Eventf(obj, corev1.EventTypeNormal, "DriftCorrected", "%s %s corrected: %s", kind, id, strings.Join(drift, ", "))
+	}
 }
 
 func (r *LoggingSetupReconciler) finalizeLoggingSetup(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup) error {
-	log.Info("Finalization: Deleting Graylog Resources")
 
 	var (
 		err error
 	)
 
-	err = graylog.DeleteStream(ctx, log, obj.Status.GraylogStatus.StreamID)
+	data := &graylog.GraylogProvisioningData{
+		Name:     obj.Namespace,
+		OwnerUID: string(obj.UID),
+	}
+
+	data.User.ID = obj.Status.GraylogStatus.UserID
+	data.IndexSet.ID = obj.Status.GraylogStatus.IndexSetID
+	data.Stream.ID = obj.Status.GraylogStatus.StreamID
+
+	// the tokens are revoked with every deletion policy, as their Secret is deleted with the LoggingSetup
+	if data.User.ID != "" {
+		err = r.revokeTokens(ctx, log, obj, data)
+		if err != nil {
+			log.Error(err, "Error revoking Tokens")
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, "TokensRevokeFailed", "Failed to revoke tokens of user %s: %s", data.User.ID, err)
+			return err
+		}
+	}
+
+	if obj.Spec.DeletionPolicy == v1alpha1.DeletionPolicy_Retain {
+		log.Info("Finalization: Retaining Graylog Resources")
+		r.Recorder.Event(obj, corev1.EventTypeNormal, "Retained", "Graylog objects retained by the deletion policy, API tokens revoked")
+		return nil
+	}
+
+	log.Info("Finalization: Deleting Graylog Resources")
+	r.Recorder.Event(obj, corev1.EventTypeNormal, "Finalizing", "Deleting Graylog objects")
+
+	err = graylog.DeleteStream(ctx, r.Graylog, log, data)
 	if err != nil {
 		log.Error(err, "Error deleting Stream")
-		return err
+		return r.blockDeletion(obj, "Stream", err)
 	}
+	r.recordDeletion(obj, "Stream", data.Stream.ID)
 
-	err = graylog.DeleteIndexSet(ctx, log, obj.Status.GraylogStatus.IndexSetID)
+	err = graylog.DeleteIndexSet(ctx, r.Graylog, log, data)
 	if err != nil {
 		log.Error(err, "Error deleting IndexSet")
-		return err
+		return r.blockDeletion(obj, "IndexSet", err)
 	}
+	r.recordDeletion(obj, "IndexSet", data.IndexSet.ID)
 
-	err = graylog.DeleteUser(ctx, log, obj.Status.GraylogStatus.UserID)
+	err = graylog.DeleteUser(ctx, r.Graylog, log, data)
 	if err != nil {
 		log.Error(err, "Error deleting User")
-		return err
+		return r.blockDeletion(obj, "User", err)
 	}
+	r.recordDeletion(obj, "User", data.User.ID)
 
 	return nil
 }
 
+// recordDeletion emits an event for a deleted Graylog object
+func (r *LoggingSetupReconciler) recordDeletion(obj *v1alpha1.LoggingSetup, kind, id string) {
+	if id == "" {
+		return
+	}
+
+	r.Recorder.Eventf(obj, corev1.EventTypeNormal, kind+"Deleted", "%s %s deleted", kind, id)
+}
+
+// blockDeletion records the failed deletion, and sets the DeletionBlocked condition if err is caused
+// by an object not owned by obj
+func (r *LoggingSetupReconciler) blockDeletion(obj *v1alpha1.LoggingSetup, kind string, err error) error {
+	if graylog.IsNotOwned(err) {
+		meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+			Type:    CONDIIONTYPE_DELETION_BLOCKED,
+			Status:  metav1.ConditionTrue,
+			Reason:  "NotOwned",
+			Message: err.Error(),
+		})
+
+		r.Recorder.Event(obj, corev1.EventTypeWarning, "DeletionBlocked", err.Error())
+	} else {
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, kind+"DeleteFailed", "Failed to delete %s: %s", kind, err)
+	}
+
+	return err
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *LoggingSetupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
-	// the Graylog API for configruation issues
-	client, err := graylog.CreateClient(r.Log)
-	if err != nil {
-		r.Log.Error(err, "Unable to create the client")
-		return err
+	if r.Naming == nil {
+		naming, err := graylog.NewNaming("", "", "", "", "")
+		if err != nil {
+			return err
+		}
+		r.Naming = naming
 	}
 
-	err = client.Test(context.Background())
-	if err != nil {
-		r.Log.Error(err, "Unable execute test call")
+	if r.Graylog == nil {
+		config, err := graylog.ConfigFromEnv()
+		if err != nil {
+			r.Log.Error(err, "Unable to create the client")
+			return err
+		}
+		r.Graylog, err = graylog.NewClient(config, r.Log)
+		if err != nil {
+			r.Log.Error(err, "Unable to create the client")
+			return err
+		}
+	}
+
+	// the collector may be registered already, if the controller is set up again (e.g. in tests)
+	err := metrics.Registry.Register(&loggingSetupCollector{client: mgr.GetClient()})
+	if err != nil && !goerrors.As(err, &prometheus.AlreadyRegisteredError{}) {
 		return err
 	}
 
+	options := controller.Options{}
+	if r.RequeueBaseDelay > 0 && r.RequeueMaxDelay > 0 {
+		options.RateLimiter = workqueue.NewItemExponentialFailureRateLimiter(r.RequeueBaseDelay, r.RequeueMaxDelay)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
+		WithOptions(options).
 		For(&loggingv1alpha1.LoggingSetup{}).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&source.Kind{Type: &loggingv1alpha1.LoggingSetupClass{}}, handler.EnqueueRequestsFromMapFunc(r.loggingSetupsForClass)).
+		Watches(&source.Kind{Type: &loggingv1alpha1.LoggingPolicy{}}, handler.EnqueueRequestsFromMapFunc(r.loggingSetupsForPolicy)).
 		Complete(r)
 }
@@ -0,0 +1,49 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+func TestIsPermanent(t *testing.T) {
+
+	notOwned := &graylog.NotOwnedError{Kind: "User", ID: "1", Marker: "someone@example.com", Action: "update"}
+	failed := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"not owned", notOwned, true},
+		{"other error", failed, false},
+		{"all not owned", utilerrors.NewAggregate([]error{notOwned, notOwned}), true},
+		{"mixed", utilerrors.NewAggregate([]error{notOwned, failed}), false},
+	}
+
+	for _, test := range tests {
+		if permanent := isPermanent(test.err); permanent != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, permanent)
+		}
+	}
+}
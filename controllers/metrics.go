@@ -0,0 +1,170 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+)
+
+const METRICS_NAMESPACE = "wd_k8s_operator"
+
+var (
+	// graylogServerInfo exposes the version of Graylog as a label, the value is always 1
+	graylogServerInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "graylog_server_info",
+		Help:      "The version of the Graylog server, the value is always 1.",
+	}, []string{"version"})
+
+	graylogUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "graylog_up",
+		Help:      "1 if the last health check of the Graylog cluster succeeded, 0 otherwise.",
+	})
+
+	graylogRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "graylog_request_duration_seconds",
+		Help:      "The duration of requests to the Graylog API, code is \"error\" if no response has been received.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "endpoint", "code"})
+
+	provisioningTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "provisioning_total",
+		Help:      "The number of provisionings of a Graylog object by step and result.",
+	}, []string{"step", "result"})
+
+	finalizerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: METRICS_NAMESPACE,
+		Name:      "finalizer_duration_seconds",
+		Help:      "The duration of deleting the Graylog objects of a LoggingSetup by result.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"result"})
+
+	loggingSetupsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(METRICS_NAMESPACE, "", "loggingsetups"),
+		"The number of LoggingSetups by Ready state, which is True if the User, IndexSet and Stream are provisioned.",
+		[]string{"ready"}, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(graylogServerInfo, graylogUp, graylogRequestDuration, provisioningTotal, finalizerDuration)
+}
+
+// recordGraylogVersion replaces the version of the metric, if Graylog has been upgraded
+func recordGraylogVersion(version string) {
+	graylogServerInfo.Reset()
+	graylogServerInfo.WithLabelValues(version).Set(1)
+}
+
+// recordGraylogUp records the result of the last health check
+func recordGraylogUp(up bool) {
+	if up {
+		graylogUp.Set(1)
+	} else {
+		graylogUp.Set(0)
+	}
+}
+
+// ObserveGraylogRequest records the duration of a Graylog API request, it is a graylog.RequestObserver
+func ObserveGraylogRequest(method, endpoint string, statusCode int, duration time.Duration) {
+	code := "error"
+	if statusCode != 0 {
+		code = strconv.Itoa(statusCode)
+	}
+
+	graylogRequestDuration.WithLabelValues(method, endpoint, code).Observe(duration.Seconds())
+}
+
+// recordProvisioningResult counts a provisioning step by its result
+func recordProvisioningResult(step string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	provisioningTotal.WithLabelValues(step, result).Inc()
+}
+
+// recordFinalizerDuration observes the duration of a finalization started at start
+func recordFinalizerDuration(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	finalizerDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// loggingSetupCollector counts the LoggingSetups by Ready state on every scrape, read from the cache of the manager
+type loggingSetupCollector struct {
+	client client.Reader
+}
+
+func (c *loggingSetupCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- loggingSetupsDesc
+}
+
+func (c *loggingSetupCollector) Collect(ch chan<- prometheus.Metric) {
+
+	list := &v1alpha1.LoggingSetupList{}
+	if err := c.client.List(context.Background(), list); err != nil {
+		// the metric is missing then, which is detected by absent() alerts
+		return
+	}
+
+	counts := map[metav1.ConditionStatus]int{
+		metav1.ConditionTrue:    0,
+		metav1.ConditionFalse:   0,
+		metav1.ConditionUnknown: 0,
+	}
+	for i := range list.Items {
+		counts[readyState(&list.Items[i])]++
+	}
+
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(loggingSetupsDesc, prometheus.GaugeValue, float64(count), string(state))
+	}
+}
+
+// readyState combines the provisioning conditions: False if any is False, Unknown if any is Unknown or missing
+func readyState(obj *v1alpha1.LoggingSetup) metav1.ConditionStatus {
+
+	state := metav1.ConditionTrue
+	for _, conditionType := range []string{CONDIIONTYPE_USER, CONDIIONTYPE_INDEXSET, CONDIIONTYPE_STREAM} {
+		condition := meta.FindStatusCondition(obj.Status.Conditions, conditionType)
+		switch {
+		case condition != nil && condition.Status == metav1.ConditionFalse:
+			return metav1.ConditionFalse
+		case condition == nil || condition.Status == metav1.ConditionUnknown:
+			state = metav1.ConditionUnknown
+		}
+	}
+
+	return state
+}
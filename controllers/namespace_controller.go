@@ -0,0 +1,217 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	loggingv1alpha1 "github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+)
+
+// NamespaceReconciler creates a LoggingSetup for every Namespace labelled with LABEL_LOGGING_ENABLED,
+// and deletes it again when the label is removed
+type NamespaceReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+const (
+	// LABEL_LOGGING_ENABLED enables the automatic LoggingSetup for a Namespace, if set to "true"
+	LABEL_LOGGING_ENABLED = "logging.world-direct.at/enabled"
+
+	// LABEL_MANAGED_BY marks LoggingSetups created by the NamespaceReconciler
+	LABEL_MANAGED_BY = "app.kubernetes.io/managed-by"
+	MANAGED_BY_VALUE = "wd-k8s-operator-namespace-controller"
+
+	// AUTO_LOGGINGSETUP_NAME is the name of the created LoggingSetups
+	AUTO_LOGGINGSETUP_NAME = "logging"
+
+	// Namespace annotations overriding the defaults of the created LoggingSetup
+	ANNOTATION_CLASS_NAME        = "logging.world-direct.at/class-name"
+	ANNOTATION_DELETION_POLICY   = "logging.world-direct.at/deletion-policy"
+	ANNOTATION_PASSWORD_ROTATION = "logging.world-direct.at/password-rotation"
+	ANNOTATION_TOKENS            = "logging.world-direct.at/tokens"
+)
+
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("namespace", req.Name)
+
+	ns := &corev1.Namespace{}
+	err := r.Get(ctx, req.NamespacedName, ns)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the LoggingSetup is deleted with the Namespace
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// a Namespace has a single LoggingSetup, as all of them would provision the same Graylog objects
+	list := &loggingv1alpha1.LoggingSetupList{}
+	if err := r.List(ctx, list, client.InNamespace(ns.Name)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var obj *loggingv1alpha1.LoggingSetup
+	for i := range list.Items {
+		// never touch LoggingSetups created by others
+		if list.Items[i].Labels[LABEL_MANAGED_BY] != MANAGED_BY_VALUE {
+			log.V(1).Info("Namespace has a LoggingSetup not managed by the namespace controller, ignoring it", "loggingsetup", list.Items[i].Name)
+			return ctrl.Result{}, nil
+		}
+		obj = &list.Items[i]
+	}
+	exists := obj != nil
+
+	enabled := ns.Labels[LABEL_LOGGING_ENABLED] == "true" && ns.DeletionTimestamp == nil
+
+	if !enabled {
+		if exists && obj.DeletionTimestamp == nil {
+			// the finalizer of the LoggingSetup respects its deletion policy
+			log.Info("Logging disabled, deleting LoggingSetup")
+			return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, obj))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if exists && obj.DeletionTimestamp != nil {
+		// create it again after the finalizer is done
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	// invalid annotations are reported, the Namespace is reconciled again when they are changed
+	spec, err := specFromAnnotations(ns)
+	if err != nil {
+		log.Error(err, "Invalid annotation, LoggingSetup not changed")
+		r.Recorder.Eventf(ns, corev1.EventTypeWarning, "InvalidAnnotation", "LoggingSetup not changed: %s", err)
+		return ctrl.Result{}, nil
+	}
+
+	if !exists {
+		// the LoggingSetup controller generates the password and writes it to the credentials Secret,
+		// so that it is never stored in the spec or the Namespace
+		obj = &loggingv1alpha1.LoggingSetup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      AUTO_LOGGINGSETUP_NAME,
+				Namespace: ns.Name,
+				Labels: map[string]string{
+					LABEL_MANAGED_BY: MANAGED_BY_VALUE,
+				},
+			},
+			Spec: *spec,
+		}
+
+		log.Info("Logging enabled, creating LoggingSetup")
+		return ctrl.Result{}, r.reportInvalid(ns, r.Create(ctx, obj))
+	}
+
+	// the initial password is only used on creation, so it is not updated
+	spec.InitialUserPassword = obj.Spec.InitialUserPassword
+	spec.Adopt = obj.Spec.Adopt
+
+	// without the annotation, a class set on the LoggingSetup itself is kept
+	if spec.ClassName == "" {
+		spec.ClassName = obj.Spec.ClassName
+	}
+
+	if !equality.Semantic.DeepEqual(&obj.Spec, spec) {
+		log.Info("Annotations changed, updating LoggingSetup")
+		obj.Spec = *spec
+		return ctrl.Result{}, r.reportInvalid(ns, r.Update(ctx, obj))
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reportInvalid emits an event for a LoggingSetup rejected by the validation, as retrying it can't succeed
+func (r *NamespaceReconciler) reportInvalid(ns *corev1.Namespace, err error) error {
+	if errors.IsInvalid(err) || (errors.IsForbidden(err) && strings.Contains(err.Error(), "denied the request")) {
+		r.Recorder.Eventf(ns, corev1.EventTypeWarning, "InvalidLoggingSetup", "LoggingSetup rejected: %s", err)
+		return nil
+	}
+	return err
+}
+
+// specFromAnnotations returns the spec of the LoggingSetup with the defaults overridden by the annotations
+func specFromAnnotations(ns *corev1.Namespace) (*loggingv1alpha1.LoggingSetupSpec, error) {
+
+	spec := &loggingv1alpha1.LoggingSetupSpec{
+		Isolation: loggingv1alpha1.Isolation_Namespace,
+	}
+
+	spec.ClassName = ns.Annotations[ANNOTATION_CLASS_NAME]
+
+	switch policy := ns.Annotations[ANNOTATION_DELETION_POLICY]; policy {
+	case "":
+	case loggingv1alpha1.DeletionPolicy_Delete, loggingv1alpha1.DeletionPolicy_Retain:
+		spec.DeletionPolicy = loggingv1alpha1.DeletionPolicy(policy)
+	default:
+		return nil, fmt.Errorf("invalid %s annotation '%s', must be %s or %s", ANNOTATION_DELETION_POLICY, policy,
+			loggingv1alpha1.DeletionPolicy_Delete, loggingv1alpha1.DeletionPolicy_Retain)
+	}
+
+	if rotation := ns.Annotations[ANNOTATION_PASSWORD_ROTATION]; rotation != "" {
+		d, err := time.ParseDuration(rotation)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %s", ANNOTATION_PASSWORD_ROTATION, err)
+		}
+		spec.User = &loggingv1alpha1.UserSpec{PasswordRotation: &metav1.Duration{Duration: d}}
+	}
+
+	for _, name := range strings.Split(ns.Annotations[ANNOTATION_TOKENS], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			spec.Tokens = append(spec.Tokens, loggingv1alpha1.TokenSpec{Name: name})
+		}
+	}
+
+	return spec, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	// reconcile the Namespace when its LoggingSetup changes, e.g. to create it again after a manual delete
+	mapToNamespace := handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetNamespace()}}}
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Namespace{}).
+		Watches(&source.Kind{Type: &loggingv1alpha1.LoggingSetup{}}, mapToNamespace).
+		Complete(r)
+}
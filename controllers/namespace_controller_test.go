@@ -0,0 +1,132 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+)
+
+func testNamespace(annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "tenant",
+			Labels:      map[string]string{LABEL_LOGGING_ENABLED: "true"},
+			Annotations: annotations,
+		},
+	}
+}
+
+func reconcileNamespace(t *testing.T, objs ...client.Object) (*NamespaceReconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+	r := &NamespaceReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(objs...).Build(),
+		Log:      logr.Discard(),
+		Scheme:   testScheme(),
+		Recorder: recorder,
+	}
+
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "tenant"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, recorder
+}
+
+func listLoggingSetups(t *testing.T, r *NamespaceReconciler) []v1alpha1.LoggingSetup {
+	list := &v1alpha1.LoggingSetupList{}
+	if err := r.List(context.Background(), list, client.InNamespace("tenant")); err != nil {
+		t.Fatal(err)
+	}
+	return list.Items
+}
+
+func TestNamespaceCreatesLoggingSetup(t *testing.T) {
+
+	r, _ := reconcileNamespace(t, testNamespace(map[string]string{
+		ANNOTATION_DELETION_POLICY: v1alpha1.DeletionPolicy_Retain,
+		ANNOTATION_TOKENS:          "ci, deploy",
+	}))
+
+	items := listLoggingSetups(t, r)
+	if len(items) != 1 {
+		t.Fatalf("expected 1 LoggingSetup, got %d", len(items))
+	}
+
+	obj := items[0]
+	if obj.Name != AUTO_LOGGINGSETUP_NAME || obj.Spec.DeletionPolicy != v1alpha1.DeletionPolicy_Retain || len(obj.Spec.Tokens) != 2 {
+		t.Errorf("unexpected LoggingSetup %s with spec %+v", obj.Name, obj.Spec)
+	}
+
+	if obj.Spec.InitialUserPassword != "" {
+		t.Error("expected no password in the spec")
+	}
+}
+
+func TestNamespaceWithOtherLoggingSetup(t *testing.T) {
+
+	other := &v1alpha1.LoggingSetup{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "tenant"}}
+
+	r, _ := reconcileNamespace(t, testNamespace(nil), other)
+
+	if items := listLoggingSetups(t, r); len(items) != 1 || items[0].Name != "custom" {
+		t.Errorf("expected only the existing LoggingSetup, got %v", items)
+	}
+}
+
+func TestNamespaceInvalidDeletionPolicy(t *testing.T) {
+
+	r, recorder := reconcileNamespace(t, testNamespace(map[string]string{ANNOTATION_DELETION_POLICY: "Keep"}))
+
+	if items := listLoggingSetups(t, r); len(items) != 0 {
+		t.Errorf("expected no LoggingSetup, got %v", items)
+	}
+
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected an event for the invalid annotation, got %d", len(recorder.Events))
+	}
+}
+
+func TestNamespaceKeepsClass(t *testing.T) {
+
+	existing := &v1alpha1.LoggingSetup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      AUTO_LOGGINGSETUP_NAME,
+			Namespace: "tenant",
+			Labels:    map[string]string{LABEL_MANAGED_BY: MANAGED_BY_VALUE},
+		},
+		Spec: v1alpha1.LoggingSetupSpec{Isolation: v1alpha1.Isolation_Namespace, ClassName: "gold"},
+	}
+
+	r, _ := reconcileNamespace(t, testNamespace(map[string]string{ANNOTATION_DELETION_POLICY: v1alpha1.DeletionPolicy_Retain}), existing)
+
+	items := listLoggingSetups(t, r)
+	if len(items) != 1 || items[0].Spec.ClassName != "gold" || items[0].Spec.DeletionPolicy != v1alpha1.DeletionPolicy_Retain {
+		t.Errorf("expected the class kept and the deletion policy updated, got %+v", items)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+const (
+	// the delay to retry a failed password rotation
+	passwordRetryDelay = time.Minute
+
+	passwordLength = 24
+	passwordChars  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
+
+// passwordChangeReason returns why the password needs to be changed, or an empty string if it doesn't
+func passwordChangeReason(obj *v1alpha1.LoggingSetup, now time.Time) string {
+
+	if request := obj.Annotations[v1alpha1.ANNOTATION_RESET_PASSWORD]; request != "" && request != obj.Status.PasswordResetRequest {
+		return "reset requested"
+	}
+
+	if obj.Spec.User != nil && obj.Spec.User.PasswordRotation != nil && obj.Spec.User.PasswordRotation.Duration > 0 {
+		last := obj.CreationTimestamp.Time
+		if obj.Status.LastPasswordRotation != nil {
+			last = obj.Status.LastPasswordRotation.Time
+		}
+
+		if now.Sub(last) >= obj.Spec.User.PasswordRotation.Duration {
+			return "rotation interval elapsed"
+		}
+	}
+
+	return ""
+}
+
+// passwordRotationAfter returns the delay until the next password rotation of obj is due, 0 if disabled
+func passwordRotationAfter(obj *v1alpha1.LoggingSetup, now time.Time) time.Duration {
+
+	if obj.Spec.User == nil || obj.Spec.User.PasswordRotation == nil || obj.Spec.User.PasswordRotation.Duration <= 0 {
+		return 0
+	}
+
+	last := obj.CreationTimestamp.Time
+	if obj.Status.LastPasswordRotation != nil {
+		last = obj.Status.LastPasswordRotation.Time
+	}
+
+	// an overdue rotation failed in this reconcile, it is retried later instead of immediately
+	next := last.Add(obj.Spec.User.PasswordRotation.Duration).Sub(now)
+	if next <= 0 {
+		next = passwordRetryDelay
+	}
+	return next
+}
+
+// changePassword sets a new random password for the Graylog user, if a reset is requested or the rotation is due.
+// The password is written to the credentials Secret only after Graylog accepted it. If writing the Secret fails,
+// the status is not updated, so that the next reconcile sets another password and writes it again.
+func (r *LoggingSetupReconciler) changePassword(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, data *graylog.GraylogProvisioningData) error {
+
+	now := time.Now()
+	reason := passwordChangeReason(obj, now)
+	if reason == "" {
+		return nil
+	}
+
+	log.Info("Changing password", "reason", reason)
+
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+
+	err = graylog.SetUserPassword(ctx, r.Graylog, log, data, password)
+	if err != nil {
+		return err
+	}
+
+	secret, err := r.writeCredentials(ctx, obj, data.User.Name, password)
+	if err != nil {
+		return err
+	}
+
+	obj.Status.LastPasswordRotation = &metav1.Time{Time: now}
+	obj.Status.PasswordResetRequest = obj.Annotations[v1alpha1.ANNOTATION_RESET_PASSWORD]
+
+	r.Recorder.Eventf(obj, corev1.EventTypeNormal, "PasswordChanged", "Password of user %s changed (%s), see Secret %s", data.User.Name, reason, secret.Name)
+	return nil
+}
+
+// storeGeneratedPassword writes the password of a user created without an initial password to the credentials Secret.
+// If this fails the password is lost, and a reset must be requested by the annotation.
+func (r *LoggingSetupReconciler) storeGeneratedPassword(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, data *graylog.GraylogProvisioningData) error {
+
+	if data.User.Result != graylog.RESULT_CREATED || obj.Spec.InitialUserPassword != "" {
+		return nil
+	}
+
+	secret, err := r.writeCredentials(ctx, obj, data.User.Name, data.User.InitialPassword)
+	if err != nil {
+		return err
+	}
+
+	obj.Status.LastPasswordRotation = &metav1.Time{Time: time.Now()}
+
+	log.Info("Generated password stored", "secret", secret.Name)
+	return nil
+}
+
+// writeCredentials creates or updates the credentials Secret of obj
+func (r *LoggingSetupReconciler) writeCredentials(ctx context.Context, obj *v1alpha1.LoggingSetup, username, password string) (*corev1.Secret, error) {
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      obj.CredentialsSecretName(),
+			Namespace: obj.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Type = corev1.SecretTypeBasicAuth
+		secret.Data = map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte(username),
+			corev1.BasicAuthPasswordKey: []byte(password),
+		}
+
+		return controllerutil.SetControllerReference(obj, secret, r.Scheme)
+	})
+
+	return secret, err
+}
+
+func generatePassword() (string, error) {
+	password := make([]byte, passwordLength)
+	max := big.NewInt(int64(len(passwordChars)))
+
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		password[i] = passwordChars[n.Int64()]
+	}
+
+	return string(password), nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+var passwordTestNow = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testPasswordLoggingSetup returns a LoggingSetup created a day ago, with the given rotation interval (0 for none)
+func testPasswordLoggingSetup(rotation time.Duration, lastRotation *time.Time) *v1alpha1.LoggingSetup {
+	obj := &v1alpha1.LoggingSetup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "logging",
+			Namespace:         "tenant",
+			CreationTimestamp: metav1.Time{Time: passwordTestNow.Add(-24 * time.Hour)},
+		},
+	}
+
+	if rotation > 0 {
+		obj.Spec.User = &v1alpha1.UserSpec{PasswordRotation: &metav1.Duration{Duration: rotation}}
+	}
+
+	if lastRotation != nil {
+		obj.Status.LastPasswordRotation = &metav1.Time{Time: *lastRotation}
+	}
+
+	return obj
+}
+
+func TestPasswordChangeReason(t *testing.T) {
+
+	hourAgo := passwordTestNow.Add(-time.Hour)
+
+	requested := testPasswordLoggingSetup(0, nil)
+	requested.Annotations = map[string]string{v1alpha1.ANNOTATION_RESET_PASSWORD: "1"}
+
+	handled := testPasswordLoggingSetup(0, nil)
+	handled.Annotations = map[string]string{v1alpha1.ANNOTATION_RESET_PASSWORD: "1"}
+	handled.Status.PasswordResetRequest = "1"
+
+	tests := []struct {
+		name     string
+		obj      *v1alpha1.LoggingSetup
+		expected string
+	}{
+		{"nothing", testPasswordLoggingSetup(0, nil), ""},
+		{"reset requested", requested, "reset requested"},
+		{"reset handled", handled, ""},
+		{"rotation due since creation", testPasswordLoggingSetup(12*time.Hour, nil), "rotation interval elapsed"},
+		{"rotation not due since creation", testPasswordLoggingSetup(48*time.Hour, nil), ""},
+		{"rotation not due since last rotation", testPasswordLoggingSetup(12*time.Hour, &hourAgo), ""},
+	}
+
+	for _, test := range tests {
+		if reason := passwordChangeReason(test.obj, passwordTestNow); reason != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, reason)
+		}
+	}
+}
+
+func TestPasswordRotationAfter(t *testing.T) {
+
+	hourAgo := passwordTestNow.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		obj      *v1alpha1.LoggingSetup
+		expected time.Duration
+	}{
+		{"disabled", testPasswordLoggingSetup(0, nil), 0},
+		{"since creation", testPasswordLoggingSetup(48*time.Hour, nil), 24 * time.Hour},
+		{"since last rotation", testPasswordLoggingSetup(12*time.Hour, &hourAgo), 11 * time.Hour},
+		{"overdue", testPasswordLoggingSetup(12*time.Hour, nil), passwordRetryDelay},
+	}
+
+	for _, test := range tests {
+		if after := passwordRotationAfter(test.obj, passwordTestNow); after != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, after)
+		}
+	}
+}
+
+func TestStoreGeneratedPassword(t *testing.T) {
+
+	obj := testPasswordLoggingSetup(0, nil)
+	r := testLoggingSetupReconciler(nil, obj)
+
+	data := &graylog.GraylogProvisioningData{Name: "tenant"}
+	data.User.Name = "tenant"
+	data.User.InitialPassword = "generated"
+	data.User.Result = graylog.RESULT_CREATED
+
+	if err := r.storeGeneratedPassword(context.Background(), logr.Discard(), obj, data); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "tenant", Name: obj.CredentialsSecretName()}, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if password := string(secret.Data[corev1.BasicAuthPasswordKey]); password != "generated" {
+		t.Errorf("unexpected password %q", password)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	"github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+// set if the LoggingSetup violates a LoggingPolicy, nothing is provisioned then
+const CONDIIONTYPE_POLICY_VIOLATION = "PolicyViolation"
+
+//+kubebuilder:rbac:groups=logging.world-direct.at,resources=loggingpolicies,verbs=get;list;watch
+
+// checkPolicies updates the PolicyViolation condition and returns false if obj must not be provisioned.
+// The error is returned if the policies couldn't be read, so that the check is retried.
+// Violations are not clamped, the LoggingSetup is left as it is until the class or the policy is fixed.
+func (r *LoggingSetupReconciler) checkPolicies(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, class *v1alpha1.LoggingSetupClass) (bool, error) {
+
+	spec := v1alpha1.LoggingSetupClassSpec{}
+	if class != nil {
+		spec = class.Spec
+	}
+
+	template, err := TemplateResolver(r.Graylog)(ctx, spec.EffectiveIndexSetTemplate())
+	if err != nil {
+		log.Error(err, "Failed to read the IndexSet template")
+		setAllConditionsFalse(obj, "PolicyError", err)
+		return false, err
+	}
+
+	violations, err := v1alpha1.PolicyViolations(ctx, r.Client, class, template)
+	if err != nil {
+		log.Error(err, "Failed to check LoggingPolicies")
+		setAllConditionsFalse(obj, "PolicyError", err)
+		return false, err
+	}
+
+	if len(violations) == 0 {
+		meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+			Type:    CONDIIONTYPE_POLICY_VIOLATION,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Compliant",
+			Message: "The LoggingSetup complies with all LoggingPolicies",
+		})
+		return true, nil
+	}
+
+	message := strings.Join(violations, "; ")
+	log.Info("LoggingSetup violates LoggingPolicies", "violations", violations)
+
+	if !meta.IsStatusConditionTrue(obj.Status.Conditions, CONDIIONTYPE_POLICY_VIOLATION) {
+		r.Recorder.Event(obj, corev1.EventTypeWarning, "PolicyViolation", message)
+	}
+
+	meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+		Type:    CONDIIONTYPE_POLICY_VIOLATION,
+		Status:  metav1.ConditionTrue,
+		Reason:  "LimitsExceeded",
+		Message: message,
+	})
+	setAllConditionsFalse(obj, "PolicyViolation", errors.New(message))
+
+	return false, nil
+}
+
+// TemplateResolver returns a resolver of the IndexSet templates in Graylog, used to check the LoggingPolicies
+func TemplateResolver(api graylog.GraylogAPI) v1alpha1.TemplateResolver {
+	return func(ctx context.Context, title string) (*v1alpha1.IndexSetTemplateSettings, error) {
+
+		settings, err := graylog.GetTemplateSettings(ctx, api, title)
+		if err != nil || settings == nil {
+			return nil, err
+		}
+
+		return &v1alpha1.IndexSetTemplateSettings{RetentionDays: settings.RetentionDays, Shards: settings.Shards}, nil
+	}
+}
+
+// loggingSetupsForPolicy maps a LoggingPolicy to all LoggingSetups, because every policy applies to all of them
+func (r *LoggingSetupReconciler) loggingSetupsForPolicy(o client.Object) []reconcile.Request {
+
+	list := &v1alpha1.LoggingSetupList{}
+	if err := r.List(context.Background(), list); err != nil {
+		r.Log.Error(err, "Failed to list LoggingSetups for policy", "policy", o.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, obj := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name},
+		})
+	}
+
+	return requests
+}
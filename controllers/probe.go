@@ -0,0 +1,174 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+const (
+	// set by the delivery probe, if the probe message has been found in the Stream
+	CONDIIONTYPE_LOG_DELIVERY = "LogDeliveryVerified"
+
+	// the interval to search for a sent probe message
+	PROBE_POLL_INTERVAL = 10 * time.Second
+)
+
+// probeDelivery sends a probe message if the ProbeInterval elapsed, or searches a sent one in the Stream.
+// It never blocks until the message arrives, the reconcile is requeued by probeRequeueAfter instead.
+func (r *LoggingSetupReconciler) probeDelivery(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, data *graylog.GraylogProvisioningData) {
+
+	if r.ProbeInterval <= 0 || r.ProbeAddress == "" {
+		return
+	}
+
+	if data.Stream.ID == "" || !meta.IsStatusConditionTrue(obj.Status.Conditions, CONDIIONTYPE_STREAM) {
+		return
+	}
+
+	now := time.Now()
+	if obj.Status.DeliveryProbe == nil {
+		obj.Status.DeliveryProbe = &v1alpha1.DeliveryProbeStatus{}
+	}
+	probe := obj.Status.DeliveryProbe
+
+	if probe.PendingID != "" && probe.LastSent != nil {
+		sent := probe.LastSent.Time
+
+		received, err := graylog.FindProbe(ctx, r.Graylog, log, data, probe.PendingID, now.Sub(sent))
+		if err != nil {
+			// keep the probe pending, the search is retried
+			log.Error(err, "Failed to search probe message")
+			return
+		}
+
+		if received != nil {
+			latency := received.Sub(sent)
+			if latency < 0 {
+				latency = 0
+			}
+
+			probe.PendingID = ""
+			probe.LastVerified = &metav1.Time{Time: now}
+			probe.Latency = &metav1.Duration{Duration: latency}
+
+			meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+				Type:    CONDIIONTYPE_LOG_DELIVERY,
+				Status:  metav1.ConditionTrue,
+				Reason:  "Delivered",
+				Message: fmt.Sprintf("Probe message received by Graylog after %s", latency.Round(time.Millisecond)),
+			})
+			return
+		}
+
+		if now.Sub(sent) < r.ProbeTimeout {
+			return
+		}
+
+		log.Info("Probe message not found in stream", "id", probe.PendingID)
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, "LogDeliveryFailed", "Probe message %s not found in stream %s within %s", probe.PendingID, data.Stream.ID, r.ProbeTimeout)
+
+		meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+			Type:    CONDIIONTYPE_LOG_DELIVERY,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotDelivered",
+			Message: fmt.Sprintf("Probe message %s not found in the stream within %s", probe.PendingID, r.ProbeTimeout),
+		})
+		probe.PendingID = ""
+		return
+	}
+
+	if probe.LastSent != nil && now.Sub(probe.LastSent.Time) < r.ProbeInterval {
+		return
+	}
+
+	id, err := generateProbeID()
+	if err != nil {
+		log.Error(err, "Failed to generate probe ID")
+		return
+	}
+
+	if err := graylog.SendProbe(ctx, log, r.ProbeAddress, data, id); err != nil {
+		log.Error(err, "Failed to send probe message")
+
+		meta.SetStatusCondition(&obj.Status.Conditions, metav1.Condition{
+			Type:    CONDIIONTYPE_LOG_DELIVERY,
+			Status:  metav1.ConditionFalse,
+			Reason:  "SendFailed",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	probe.PendingID = id
+	probe.LastSent = &metav1.Time{Time: now}
+}
+
+// probeRequeueAfter returns the delay until the delivery probe needs the next reconcile, 0 if disabled
+func (r *LoggingSetupReconciler) probeRequeueAfter(obj *v1alpha1.LoggingSetup) time.Duration {
+
+	if r.ProbeInterval <= 0 || r.ProbeAddress == "" || obj.Status.DeliveryProbe == nil {
+		return 0
+	}
+
+	probe := obj.Status.DeliveryProbe
+	if probe.PendingID != "" {
+		return PROBE_POLL_INTERVAL
+	}
+
+	if probe.LastSent == nil {
+		return 0
+	}
+
+	next := time.Until(probe.LastSent.Add(r.ProbeInterval))
+	if next < time.Second {
+		next = time.Second
+	}
+	return next
+}
+
+// onlyProbeDue returns true if obj has been requeued to search a pending probe message, and nothing else needs to be done.
+// Changes not increasing the generation, e.g. of the class, are provisioned once the probe is completed.
+func (r *LoggingSetupReconciler) onlyProbeDue(log logr.Logger, obj *v1alpha1.LoggingSetup, now time.Time) bool {
+
+	probe := obj.Status.DeliveryProbe
+	if r.ProbeInterval <= 0 || r.ProbeAddress == "" || probe == nil || probe.PendingID == "" {
+		return false
+	}
+
+	return r.provisioningUpToDate(log, obj, now)
+}
+
+func generateProbeID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
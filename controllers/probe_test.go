@@ -0,0 +1,78 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+)
+
+func TestOnlyProbeDue(t *testing.T) {
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := &LoggingSetupReconciler{ProbeInterval: time.Hour, ProbeAddress: "graylog:12201", ResyncInterval: time.Hour}
+
+	// provisioned 10 minutes ago, with a pending probe
+	pending := func() *v1alpha1.LoggingSetup {
+		obj := &v1alpha1.LoggingSetup{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+		obj.Status.ObservedGeneration = 2
+		obj.Status.LastProvisioned = &metav1.Time{Time: now.Add(-10 * time.Minute)}
+		obj.Status.DeliveryProbe = &v1alpha1.DeliveryProbeStatus{PendingID: "abc", LastSent: &metav1.Time{Time: now.Add(-time.Minute)}}
+		return obj
+	}
+
+	noProbe := pending()
+	noProbe.Status.DeliveryProbe.PendingID = ""
+
+	neverProvisioned := pending()
+	neverProvisioned.Status.LastProvisioned = nil
+
+	specChanged := pending()
+	specChanged.Generation = 3
+
+	resyncDue := pending()
+	resyncDue.Status.LastProvisioned = &metav1.Time{Time: now.Add(-2 * time.Hour)}
+
+	resetRequested := pending()
+	resetRequested.Annotations = map[string]string{v1alpha1.ANNOTATION_RESET_PASSWORD: "1"}
+
+	tests := []struct {
+		name     string
+		r        *LoggingSetupReconciler
+		obj      *v1alpha1.LoggingSetup
+		expected bool
+	}{
+		{"pending probe", r, pending(), true},
+		{"probe disabled", &LoggingSetupReconciler{ResyncInterval: time.Hour}, pending(), false},
+		{"no pending probe", r, noProbe, false},
+		{"never provisioned", r, neverProvisioned, false},
+		{"spec changed", r, specChanged, false},
+		{"resync due", r, resyncDue, false},
+		{"password reset requested", r, resetRequested, false},
+	}
+
+	for _, test := range tests {
+		if due := test.r.onlyProbeDue(logr.Discard(), test.obj, now); due != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, due)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+// reconcileTokens revokes the tokens removed from the spec, and creates the tokens missing in the status.
+// Tokens missing in the Secret are revoked and created again, because their value can't be read from Graylog.
+func (r *LoggingSetupReconciler) reconcileTokens(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, data *graylog.GraylogProvisioningData) error {
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: obj.TokensSecretName()}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	inSpec := make(map[string]bool)
+	for _, token := range obj.Spec.Tokens {
+		inSpec[token.Name] = true
+	}
+
+	// revoke tokens
+	var kept []v1alpha1.TokenStatus
+	removed := make(map[string]bool)
+	for i, token := range obj.Status.Tokens {
+		if _, inSecret := secret.Data[token.Name]; inSpec[token.Name] && inSecret {
+			kept = append(kept, token)
+			continue
+		}
+
+		if err := graylog.DeleteUserToken(ctx, r.Graylog, log, data, token.ID); err != nil {
+			obj.Status.Tokens = append(kept, obj.Status.Tokens[i:]...)
+			return err
+		}
+
+		removed[token.Name] = true
+		r.Recorder.Eventf(obj, corev1.EventTypeNormal, "TokenRevoked", "Token %s (%s) of user %s revoked", token.Name, token.ID, data.User.Name)
+	}
+	obj.Status.Tokens = kept
+
+	// create tokens
+	created := make(map[string][]byte)
+	for _, spec := range obj.Spec.Tokens {
+		if hasToken(obj.Status.Tokens, spec.Name) {
+			continue
+		}
+
+		var id, value string
+		id, value, err = graylog.CreateUserToken(ctx, r.Graylog, log, data, spec.Name)
+		if err != nil {
+			// write the created tokens before returning
+			break
+		}
+
+		obj.Status.Tokens = append(obj.Status.Tokens, v1alpha1.TokenStatus{Name: spec.Name, ID: id})
+		created[spec.Name] = []byte(value)
+		r.Recorder.Eventf(obj, corev1.EventTypeNormal, "TokenCreated", "Token %s (%s) of user %s created", spec.Name, id, data.User.Name)
+	}
+
+	if len(created) == 0 && len(removed) == 0 {
+		return err
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      obj.TokensSecretName(),
+			Namespace: obj.Namespace,
+		},
+	}
+
+	_, secretErr := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+
+		for name := range removed {
+			delete(secret.Data, name)
+		}
+
+		for name, value := range created {
+			secret.Data[name] = value
+		}
+
+		return controllerutil.SetControllerReference(obj, secret, r.Scheme)
+	})
+
+	if secretErr != nil {
+		return secretErr
+	}
+
+	return err
+}
+
+// revokeTokens revokes all tokens in the status, used by the finalizer
+func (r *LoggingSetupReconciler) revokeTokens(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, data *graylog.GraylogProvisioningData) error {
+	for len(obj.Status.Tokens) > 0 {
+		if err := graylog.DeleteUserToken(ctx, r.Graylog, log, data, obj.Status.Tokens[0].ID); err != nil {
+			return err
+		}
+
+		obj.Status.Tokens = obj.Status.Tokens[1:]
+	}
+
+	return nil
+}
+
+func hasToken(tokens []v1alpha1.TokenStatus, name string) bool {
+	for _, token := range tokens {
+		if token.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
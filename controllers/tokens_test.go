@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+// fakeTokenAPI keeps the tokens of a single user in memory, calls of other methods panic
+type fakeTokenAPI struct {
+	graylog.GraylogAPI
+
+	tokens  []graylog.Token
+	created int
+}
+
+func (api *fakeTokenAPI) ListUserTokens(ctx context.Context, userID string) ([]graylog.Token, error) {
+	return append([]graylog.Token{}, api.tokens...), nil
+}
+
+func (api *fakeTokenAPI) CreateUserToken(ctx context.Context, userID, name string) (*graylog.Token, error) {
+	api.created++
+	token := graylog.Token{ID: fmt.Sprintf("t%d", api.created), Name: name, Token: fmt.Sprintf("value%d", api.created)}
+	api.tokens = append(api.tokens, token)
+	return &token, nil
+}
+
+func (api *fakeTokenAPI) DeleteUserToken(ctx context.Context, userID, tokenID string) error {
+	for i, token := range api.tokens {
+		if token.ID == tokenID {
+			api.tokens = append(api.tokens[:i], api.tokens[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func testScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	return scheme
+}
+
+func testLoggingSetupReconciler(api graylog.GraylogAPI, objs ...client.Object) *LoggingSetupReconciler {
+	scheme := testScheme()
+	return &LoggingSetupReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Log:      logr.Discard(),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(100),
+		Graylog:  api,
+	}
+}
+
+func TestReconcileTokens(t *testing.T) {
+
+	ctx := context.Background()
+	api := &fakeTokenAPI{}
+	r := testLoggingSetupReconciler(api)
+
+	obj := &v1alpha1.LoggingSetup{
+		ObjectMeta: metav1.ObjectMeta{Name: "logging", Namespace: "tenant", UID: "uid"},
+		Spec:       v1alpha1.LoggingSetupSpec{Tokens: []v1alpha1.TokenSpec{{Name: "ci"}}},
+	}
+	data := &graylog.GraylogProvisioningData{Name: "tenant"}
+	data.User.ID = "u1"
+
+	tokenValue := func() string {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: "tenant", Name: obj.TokensSecretName()}, secret); err != nil {
+			t.Fatal(err)
+		}
+		return string(secret.Data["ci"])
+	}
+
+	// create
+	if err := r.reconcileTokens(ctx, logr.Discard(), obj, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.tokens) != 1 || len(obj.Status.Tokens) != 1 || obj.Status.Tokens[0].ID != api.tokens[0].ID {
+		t.Fatalf("unexpected tokens %v, status %v", api.tokens, obj.Status.Tokens)
+	}
+
+	if value := tokenValue(); value != api.tokens[0].Token {
+		t.Errorf("unexpected token value %q in the Secret", value)
+	}
+
+	// create again after the status update failed, the left over token must be revoked
+	obj.Status.Tokens = nil
+	if err := r.reconcileTokens(ctx, logr.Discard(), obj, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.tokens) != 1 || api.tokens[0].ID != "t2" || obj.Status.Tokens[0].ID != "t2" {
+		t.Fatalf("expected only the token t2, got %v, status %v", api.tokens, obj.Status.Tokens)
+	}
+
+	if value := tokenValue(); value != "value2" {
+		t.Errorf("unexpected token value %q in the Secret", value)
+	}
+
+	// revoke
+	obj.Spec.Tokens = nil
+	if err := r.reconcileTokens(ctx, logr.Discard(), obj, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.tokens) != 0 || len(obj.Status.Tokens) != 0 {
+		t.Fatalf("expected all tokens revoked, got %v, status %v", api.tokens, obj.Status.Tokens)
+	}
+
+	if value := tokenValue(); value != "" {
+		t.Errorf("expected the token removed from the Secret, got %q", value)
+	}
+}
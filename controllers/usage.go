@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/world-direct/wd-k8s-operator/api/v1alpha1"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+// indexRangesCache keeps the index ranges of all indices, because Graylog only lists them all at once.
+// They are listed once per UsageInterval for all LoggingSetups.
+type indexRangesCache struct {
+	mu     sync.Mutex
+	ranges []graylog.IndexRange
+	listed time.Time
+}
+
+// get returns the cached index ranges, or lists them again if they are older than maxAge
+func (c *indexRangesCache) get(ctx context.Context, api graylog.GraylogAPI, maxAge time.Duration, now time.Time) ([]graylog.IndexRange, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ranges != nil && now.Sub(c.listed) < maxAge {
+		return c.ranges, nil
+	}
+
+	ranges, err := api.ListIndexRanges(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ranges = append([]graylog.IndexRange{}, ranges...)
+	c.listed = now
+	return c.ranges, nil
+}
+
+// updateUsage reads the usage from Graylog into the status, if it is older than the UsageInterval
+func (r *LoggingSetupReconciler) updateUsage(ctx context.Context, log logr.Logger, obj *v1alpha1.LoggingSetup, data *graylog.GraylogProvisioningData) {
+
+	if r.UsageInterval <= 0 || data.Stream.ID == "" || data.IndexSet.ID == "" {
+		return
+	}
+
+	now := time.Now()
+	if !r.usageDue(obj, now) {
+		return
+	}
+
+	ranges, err := r.indexRanges.get(ctx, r.Graylog, r.UsageInterval, now)
+	if err != nil {
+		// the usage is informational only, so the previous values are kept
+		log.Error(err, "Failed to list index ranges")
+		return
+	}
+
+	usage, err := graylog.GetUsage(ctx, r.Graylog, log, data, ranges)
+	if err != nil {
+		// the usage is informational only, so the previous values are kept
+		log.Error(err, "Failed to read usage")
+		return
+	}
+
+	obj.Status.Usage = &v1alpha1.UsageStatus{
+		Throughput:  usage.Throughput,
+		Indices:     usage.Indices,
+		Documents:   usage.Documents,
+		SizeBytes:   usage.SizeBytes,
+		LastUpdated: metav1.Time{Time: now},
+	}
+
+	if usage.OldestMessage != nil {
+		obj.Status.Usage.OldestMessage = &metav1.Time{Time: *usage.OldestMessage}
+	}
+}
+
+// usageDue returns true if the usage in the status is missing or older than the UsageInterval
+func (r *LoggingSetupReconciler) usageDue(obj *v1alpha1.LoggingSetup, now time.Time) bool {
+	if r.UsageInterval <= 0 {
+		return false
+	}
+
+	return obj.Status.Usage == nil || now.Sub(obj.Status.Usage.LastUpdated.Time) >= r.UsageInterval
+}
+
+// usageRequeueAfter returns the delay until the usage of obj needs to be read again, 0 if disabled or never read
+func (r *LoggingSetupReconciler) usageRequeueAfter(obj *v1alpha1.LoggingSetup) time.Duration {
+
+	if r.UsageInterval <= 0 || obj.Status.Usage == nil {
+		return 0
+	}
+
+	// an overdue usage failed to be read in this reconcile, it is retried with the next interval
+	next := time.Until(obj.Status.Usage.LastUpdated.Add(r.UsageInterval))
+	if next <= 0 {
+		next = r.UsageInterval
+	}
+	return next
+}
+
+// onlyUsageDue returns true if obj has been requeued to read the usage, and nothing else needs to be done
+func (r *LoggingSetupReconciler) onlyUsageDue(log logr.Logger, obj *v1alpha1.LoggingSetup, now time.Time) bool {
+
+	if obj.Status.Usage == nil || !r.usageDue(obj, now) {
+		return false
+	}
+
+	return r.provisioningUpToDate(log, obj, now)
+}
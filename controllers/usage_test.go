@@ -0,0 +1,62 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
+)
+
+// fakeRangesAPI counts the listings of the index ranges, calls of other methods panic
+type fakeRangesAPI struct {
+	graylog.GraylogAPI
+
+	listed int
+}
+
+func (api *fakeRangesAPI) ListIndexRanges(ctx context.Context) ([]graylog.IndexRange, error) {
+	api.listed++
+	return []graylog.IndexRange{{IndexName: "tenant_0"}}, nil
+}
+
+func TestIndexRangesCache(t *testing.T) {
+
+	api := &fakeRangesAPI{}
+	cache := &indexRangesCache{}
+	now := time.Now()
+
+	for _, offset := range []time.Duration{0, time.Minute, 4 * time.Minute} {
+		if _, err := cache.get(context.Background(), api, 5*time.Minute, now.Add(offset)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if api.listed != 1 {
+		t.Errorf("expected the ranges to be listed once within the interval, listed %d times", api.listed)
+	}
+
+	if _, err := cache.get(context.Background(), api, 5*time.Minute, now.Add(5*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if api.listed != 2 {
+		t.Errorf("expected the ranges to be listed again after the interval, listed %d times", api.listed)
+	}
+}
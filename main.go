@@ -18,13 +18,17 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -33,6 +37,8 @@ import (
 
 	loggingv1alpha1 "github.com/world-direct/wd-k8s-operator/api/v1alpha1"
 	"github.com/world-direct/wd-k8s-operator/controllers"
+	"github.com/world-direct/wd-k8s-operator/provisioners/collector"
+	graylog "github.com/world-direct/wd-k8s-operator/provisioners/graylog"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,11 +58,94 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var clusterName, clusterFieldName string
+	var reportDriftOnly bool
+	var resyncInterval time.Duration
+	var resyncJitter float64
+	var usageInterval time.Duration
+	var enableNamespaceController bool
+	var collectorType, collectorConfigMap, collectorGelfHost string
+	var collectorGelfPort int
+	var probeAddress, ingestionHost string
+	var probeInterval, probeTimeout time.Duration
+	var graylogTimeout, graylogIdleConnTimeout time.Duration
+	var graylogMaxIdleConns, graylogMaxRetries, graylogBurst int
+	var graylogQPS float64
+	var graylogRetryBackoff, graylogRetryMaxBackoff time.Duration
+	var requeueBaseDelay, requeueMaxDelay time.Duration
+	var graylogHealthInterval, graylogBreakerOpenDuration time.Duration
+	var graylogBreakerFailures int
+	var userNameTemplate, indexSetTitleTemplate, indexPrefixTemplate, streamTitleTemplate string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&clusterName, "cluster-name", "", "The name of this cluster, available as {{.Cluster}} in the naming templates.")
+	flag.StringVar(&clusterFieldName, "cluster-field-name", "",
+		"The log field containing the cluster name. If set together with --cluster-name, "+
+			"streams only match logs of this cluster by an additional stream rule.")
+	flag.StringVar(&userNameTemplate, "user-name-template", graylog.DEFAULT_NAME_TEMPLATE,
+		"The template for the name of the Graylog user, e.g. '{{.Cluster}}-{{.Namespace}}'.")
+	flag.StringVar(&indexSetTitleTemplate, "index-set-title-template", graylog.DEFAULT_NAME_TEMPLATE,
+		"The template for the title of the Graylog index set.")
+	flag.StringVar(&indexPrefixTemplate, "index-prefix-template", graylog.DEFAULT_INDEX_PREFIX_TEMPLATE,
+		"The template for the index prefix of the Graylog index set. The result is sanitized to Graylog's index prefix rules.")
+	flag.StringVar(&streamTitleTemplate, "stream-title-template", graylog.DEFAULT_NAME_TEMPLATE,
+		"The template for the title of the Graylog stream.")
+	flag.BoolVar(&reportDriftOnly, "report-drift-only", false,
+		"Only report drift of the Graylog objects by events, without correcting it.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute,
+		"The interval to reconcile every LoggingSetup again, 0 disables the periodic resync. "+
+			"Can be overridden per LoggingSetup by the 'logging.world-direct.at/resync-interval' annotation.")
+	flag.Float64Var(&resyncJitter, "resync-jitter", 0.1,
+		"The maximum factor of the resync interval added randomly to spread the resyncs, 0 disables the jitter.")
+	flag.DurationVar(&usageInterval, "usage-interval", 5*time.Minute,
+		"The interval to read the throughput and index set usage of each LoggingSetup, independent of the resync. 0 disables it.")
+	flag.BoolVar(&enableNamespaceController, "enable-namespace-controller", true,
+		"Create a LoggingSetup for every namespace labelled with 'logging.world-direct.at/enabled=true'.")
+	flag.StringVar(&collectorType, "collector-type", "",
+		"Render the routing configuration of the log collector, either 'fluent-bit' or 'fluentd'. Empty disables it.")
+	flag.StringVar(&collectorConfigMap, "collector-configmap", "",
+		"The namespace/name of the ConfigMap for the collector configuration, required with --collector-type.")
+	flag.StringVar(&collectorGelfHost, "collector-gelf-host", "",
+		"The host of the Graylog GELF UDP input the collector sends to.")
+	flag.IntVar(&collectorGelfPort, "collector-gelf-port", 12201,
+		"The port of the Graylog GELF UDP input the collector sends to.")
+	flag.StringVar(&ingestionHost, "ingestion-host", "",
+		"The host of the Graylog GELF inputs published to the LoggingSetups. Defaults to the bind address of the input, or the host of GRAYLOG_URL.")
+	flag.StringVar(&probeAddress, "probe-gelf-address", "",
+		"The host:port of the Graylog GELF UDP input the delivery probe messages are sent to. Empty disables the probe.")
+	flag.DurationVar(&probeInterval, "probe-interval", 15*time.Minute,
+		"The interval to send a delivery probe message for every LoggingSetup, 0 disables the probe.")
+	flag.DurationVar(&probeTimeout, "probe-timeout", 2*time.Minute,
+		"The time a delivery probe message must arrive in the stream within.")
+	flag.DurationVar(&graylogTimeout, "graylog-timeout", graylog.DEFAULT_TIMEOUT,
+		"The timeout of a single call to the Graylog API.")
+	flag.IntVar(&graylogMaxIdleConns, "graylog-max-idle-conns", graylog.DEFAULT_MAX_IDLE_CONNS,
+		"The maximum number of idle keep-alive connections to the Graylog API.")
+	flag.DurationVar(&graylogIdleConnTimeout, "graylog-idle-conn-timeout", graylog.DEFAULT_IDLE_CONN_TIMEOUT,
+		"The time an idle keep-alive connection to the Graylog API is kept open.")
+	flag.IntVar(&graylogMaxRetries, "graylog-max-retries", graylog.DEFAULT_MAX_RETRIES,
+		"The number of retries of a Graylog API call failing with a connection error, 429 or 5xx.")
+	flag.DurationVar(&graylogRetryBackoff, "graylog-retry-backoff", graylog.DEFAULT_RETRY_INITIAL_BACKOFF,
+		"The delay before the first retry of a Graylog API call, doubled for every further retry.")
+	flag.DurationVar(&graylogRetryMaxBackoff, "graylog-retry-max-backoff", graylog.DEFAULT_RETRY_MAX_BACKOFF,
+		"The maximum delay between retries of a Graylog API call.")
+	flag.Float64Var(&graylogQPS, "graylog-qps", graylog.DEFAULT_QPS,
+		"The maximum number of requests per second sent to the Graylog API, 0 disables the limit.")
+	flag.IntVar(&graylogBurst, "graylog-burst", graylog.DEFAULT_BURST,
+		"The number of requests to the Graylog API which may exceed --graylog-qps at once.")
+	flag.DurationVar(&requeueBaseDelay, "requeue-base-delay", time.Second,
+		"The delay before a failed LoggingSetup is reconciled again, doubled for every further failure.")
+	flag.DurationVar(&requeueMaxDelay, "requeue-max-delay", 5*time.Minute,
+		"The maximum delay before a failed LoggingSetup is reconciled again.")
+	flag.IntVar(&graylogBreakerFailures, "graylog-breaker-failures", graylog.DEFAULT_BREAKER_FAILURE_THRESHOLD,
+		"The number of consecutive failed Graylog API calls suspending further calls, 0 disables the circuit breaker.")
+	flag.DurationVar(&graylogBreakerOpenDuration, "graylog-breaker-open-duration", graylog.DEFAULT_BREAKER_OPEN_DURATION,
+		"The time Graylog API calls are suspended by the circuit breaker, before a single call probes Graylog again.")
+	flag.DurationVar(&graylogHealthInterval, "graylog-health-interval", controllers.DEFAULT_HEALTH_INTERVAL,
+		"The interval to check the health of the Graylog cluster. Provisioning is held back while it is unhealthy.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,6 +154,11 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if resyncJitter < 0 {
+		setupLog.Error(fmt.Errorf("must not be negative, got %v", resyncJitter), "invalid flag", "flag", "resync-jitter")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -78,14 +172,110 @@ func main() {
 		os.Exit(1)
 	}
 
+	naming, err := graylog.NewNaming(clusterName, userNameTemplate, indexSetTitleTemplate, indexPrefixTemplate, streamTitleTemplate)
+	if err != nil {
+		setupLog.Error(err, "invalid naming template")
+		os.Exit(1)
+	}
+
+	graylogConfig, err := graylog.ConfigFromEnv()
+	if err != nil {
+		setupLog.Error(err, "invalid Graylog configuration")
+		os.Exit(1)
+	}
+	graylogConfig.Timeout = graylogTimeout
+	graylogConfig.MaxIdleConns = graylogMaxIdleConns
+	graylogConfig.IdleConnTimeout = graylogIdleConnTimeout
+	graylogConfig.MaxRetries = graylogMaxRetries
+	graylogConfig.RetryInitialBackoff = graylogRetryBackoff
+	graylogConfig.RetryMaxBackoff = graylogRetryMaxBackoff
+	graylogConfig.QPS = float32(graylogQPS)
+	graylogConfig.Burst = graylogBurst
+	graylogConfig.BreakerFailureThreshold = graylogBreakerFailures
+	graylogConfig.BreakerOpenDuration = graylogBreakerOpenDuration
+	graylogConfig.ObserveRequest = controllers.ObserveGraylogRequest
+
+	graylogClient, err := graylog.NewClient(graylogConfig, ctrl.Log.WithName("graylog"))
+	if err != nil {
+		setupLog.Error(err, "unable to create the Graylog client")
+		os.Exit(1)
+	}
+
+	// the manager starts even if Graylog is down, the readiness check reports its health
+	graylogHealth := controllers.NewGraylogHealth(graylogClient, ctrl.Log.WithName("health").WithName("Graylog"), graylogHealthInterval)
+	if err := mgr.Add(graylogHealth); err != nil {
+		setupLog.Error(err, "unable to add the Graylog health check")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.LoggingSetupReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("LoggingSetup"),
-		Scheme: mgr.GetScheme(),
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("LoggingSetup"),
+		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("wd-k8s-operator"),
+		Graylog:          graylogClient,
+		Health:           graylogHealth,
+		Naming:           naming,
+		ClusterFieldName: clusterFieldName,
+		ReportDriftOnly:  reportDriftOnly,
+		ResyncInterval:   resyncInterval,
+		ResyncJitter:     resyncJitter,
+		UsageInterval:    usageInterval,
+		IngestionHost:    ingestionHost,
+		ProbeAddress:     probeAddress,
+		ProbeInterval:    probeInterval,
+		ProbeTimeout:     probeTimeout,
+		RequeueBaseDelay: requeueBaseDelay,
+		RequeueMaxDelay:  requeueMaxDelay,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LoggingSetup")
 		os.Exit(1)
 	}
+	if enableNamespaceController {
+		if err = (&controllers.NamespaceReconciler{
+			Client:   mgr.GetClient(),
+			Log:      ctrl.Log.WithName("controllers").WithName("Namespace"),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("wd-k8s-operator"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Namespace")
+			os.Exit(1)
+		}
+	}
+	if collectorType != "" {
+		parts := strings.SplitN(collectorConfigMap, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || collectorGelfHost == "" {
+			setupLog.Error(nil, "--collector-configmap as namespace/name and --collector-gelf-host are required with --collector-type")
+			os.Exit(1)
+		}
+
+		if err = (&controllers.CollectorConfigReconciler{
+			Client:    mgr.GetClient(),
+			Log:       ctrl.Log.WithName("controllers").WithName("CollectorConfig"),
+			Scheme:    mgr.GetScheme(),
+			ConfigMap: types.NamespacedName{Namespace: parts[0], Name: parts[1]},
+			Config: collector.Config{
+				Type:             collectorType,
+				GelfHost:         collectorGelfHost,
+				GelfPort:         collectorGelfPort,
+				ClusterFieldName: clusterFieldName,
+				ClusterName:      clusterName,
+			},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CollectorConfig")
+			os.Exit(1)
+		}
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&loggingv1alpha1.LoggingSetup{}).SetupWebhookWithManager(mgr, controllers.TemplateResolver(graylogClient)); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LoggingSetup")
+			os.Exit(1)
+		}
+		if err = (&loggingv1alpha1.LoggingSetupClass{}).SetupWebhookWithManager(mgr, controllers.TemplateResolver(graylogClient)); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LoggingSetupClass")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -96,6 +286,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("graylog", graylogHealth.Check); err != nil {
+		setupLog.Error(err, "unable to set up ready check", "check", "graylog")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
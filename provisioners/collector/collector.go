@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TYPE_FLUENTBIT = "fluent-bit"
+	TYPE_FLUENTD   = "fluentd"
+
+	// CONFIG_KEY is the key of the rendered configuration in the ConfigMap
+	CONFIG_KEY = "graylog.conf"
+
+	// the field the GELF output creates from the kubernetes metadata, copied to other rule fields
+	NAMESPACE_FIELD = "kubernetes_namespace_name"
+)
+
+// Route forwards the logs of a Namespace to Graylog
+type Route struct {
+	Namespace string
+
+	// RuleFieldName is the field matched by the stream rule, it must contain the Namespace
+	RuleFieldName string
+}
+
+// Config contains everything needed to render the collector configuration
+type Config struct {
+	// Type is TYPE_FLUENTBIT or TYPE_FLUENTD
+	Type string
+
+	// GelfHost and GelfPort address the GELF UDP input of Graylog
+	GelfHost string
+	GelfPort int
+
+	// ClusterFieldName is added with the value of ClusterName to every record, if both are set
+	ClusterFieldName string
+	ClusterName      string
+
+	Routes []Route
+}
+
+// the data passed to the templates
+type templateData struct {
+	*Config
+
+	// Namespaces is a regex matching all routed Namespaces
+	Namespaces string
+
+	// CopyFields are the rule fields to be filled with the Namespace, besides NAMESPACE_FIELD
+	CopyFields []string
+}
+
+var templates = map[string]*template.Template{
+	TYPE_FLUENTBIT: template.Must(template.New(TYPE_FLUENTBIT).Parse(fluentBitTemplate)),
+	TYPE_FLUENTD:   template.Must(template.New(TYPE_FLUENTD).Parse(fluentdTemplate)),
+}
+
+// Render returns the collector configuration as data of a ConfigMap.
+// The output is stable for the same routes, so the ConfigMap only changes if the routes do.
+func Render(config *Config) (map[string]string, error) {
+
+	t, ok := templates[config.Type]
+	if !ok {
+		return nil, errors.Errorf("unsupported collector type '%s'", config.Type)
+	}
+
+	data := templateData{Config: config}
+
+	namespaces := map[string]bool{}
+	fields := map[string]bool{}
+	for _, route := range config.Routes {
+		namespaces[route.Namespace] = true
+		if route.RuleFieldName != "" && route.RuleFieldName != NAMESPACE_FIELD {
+			fields[route.RuleFieldName] = true
+		}
+	}
+
+	if len(namespaces) > 0 {
+		data.Namespaces = "^(" + strings.Join(sortedKeys(namespaces), "|") + ")$"
+	}
+	data.CopyFields = sortedKeys(fields)
+
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return nil, errors.Wrapf(err, "failed to render %s configuration", config.Type)
+	}
+
+	return map[string]string{CONFIG_KEY: buf.String()}, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Records tagged 'kube.*' are copied to 'graylog.*' if their Namespace has a LoggingSetup,
+// the original records are kept for other outputs.
+const fluentBitTemplate = `# Generated by wd-k8s-operator, do not edit.
+# Include this file after the kubernetes filter, it expects records tagged with 'kube.*'.
+{{- if .Namespaces }}
+
+[FILTER]
+    Name          rewrite_tag
+    Match         kube.*
+    Rule          $kubernetes['namespace_name'] {{ .Namespaces }} graylog.$TAG true
+    Emitter_Name  graylog_emitter
+
+[FILTER]
+    Name          nest
+    Match         graylog.*
+    Operation     lift
+    Nested_under  kubernetes
+    Add_prefix    kubernetes_
+{{- if or (and .ClusterFieldName .ClusterName) .CopyFields }}
+
+[FILTER]
+    Name          modify
+    Match         graylog.*
+{{- if and .ClusterFieldName .ClusterName }}
+    Set           {{ .ClusterFieldName }} {{ .ClusterName }}
+{{- end }}
+{{- range .CopyFields }}
+    Copy          kubernetes_namespace_name {{ . }}
+{{- end }}
+{{- end }}
+
+[OUTPUT]
+    Name                    gelf
+    Match                   graylog.*
+    Host                    {{ .GelfHost }}
+    Port                    {{ .GelfPort }}
+    Mode                    udp
+    Gelf_Short_Message_Key  log
+{{- end }}
+`
+
+// The events have to be routed to the @GRAYLOG label, e.g. by a copy output with a relabel store.
+const fluentdTemplate = `# Generated by wd-k8s-operator, do not edit.
+# Route the events of the kubernetes metadata filter to this label, e.g. by a 'relabel' store of a 'copy' output.
+<label @GRAYLOG>
+{{- if .Namespaces }}
+  <filter **>
+    @type grep
+    <regexp>
+      key $.kubernetes.namespace_name
+      pattern /{{ .Namespaces }}/
+    </regexp>
+  </filter>
+
+  <filter **>
+    @type record_transformer
+    enable_ruby true
+    <record>
+      kubernetes_namespace_name ${record.dig("kubernetes", "namespace_name")}
+{{- range .CopyFields }}
+      {{ . }} ${record.dig("kubernetes", "namespace_name")}
+{{- end }}
+{{- if and .ClusterFieldName .ClusterName }}
+      {{ .ClusterFieldName }} {{ .ClusterName }}
+{{- end }}
+    </record>
+  </filter>
+
+  <match **>
+    @type gelf
+    host {{ .GelfHost }}
+    port {{ .GelfPort }}
+    protocol udp
+  </match>
+{{- else }}
+  <match **>
+    @type null
+  </match>
+{{- end }}
+</label>
+`
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderFluentBit(t *testing.T) {
+
+	data, err := Render(&Config{
+		Type:             TYPE_FLUENTBIT,
+		GelfHost:         "graylog",
+		GelfPort:         12201,
+		ClusterFieldName: "cluster",
+		ClusterName:      "prod",
+		Routes: []Route{
+			{Namespace: "team-b", RuleFieldName: NAMESPACE_FIELD},
+			{Namespace: "team-a", RuleFieldName: "namespace"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := data[CONFIG_KEY]
+	for _, expected := range []string{
+		"$kubernetes['namespace_name'] ^(team-a|team-b)$ graylog.$TAG true",
+		"Set           cluster prod",
+		"Copy          kubernetes_namespace_name namespace",
+		"Host                    graylog",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected %q in\n%s", expected, config)
+		}
+	}
+}
+
+func TestRenderWithoutRoutes(t *testing.T) {
+
+	data, err := Render(&Config{Type: TYPE_FLUENTD, GelfHost: "graylog", GelfPort: 12201})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config := data[CONFIG_KEY]; strings.Contains(config, "@type gelf") || !strings.Contains(config, "@type null") {
+		t.Errorf("expected no gelf output in\n%s", config)
+	}
+
+	if _, err := Render(&Config{Type: "logstash"}); err == nil {
+		t.Error("expected an error for an unsupported type")
+	}
+}
+
+func TestRenderWithoutClusterName(t *testing.T) {
+
+	for _, collectorType := range []string{TYPE_FLUENTBIT, TYPE_FLUENTD} {
+		data, err := Render(&Config{
+			Type:             collectorType,
+			GelfHost:         "graylog",
+			GelfPort:         12201,
+			ClusterFieldName: "cluster",
+			Routes:           []Route{{Namespace: "team-a", RuleFieldName: NAMESPACE_FIELD}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if config := data[CONFIG_KEY]; strings.Contains(config, "cluster") {
+			t.Errorf("%s: expected no cluster field without a cluster name in\n%s", collectorType, config)
+		}
+	}
+}
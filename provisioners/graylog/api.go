@@ -0,0 +1,163 @@
+package graylog
+
+import (
+	"context"
+	"time"
+)
+
+// GraylogAPI contains the calls of the Graylog REST API used by the operator.
+// Get methods return nil without an error if the object doesn't exist,
+// Delete methods don't return an error if the object is already gone.
+type GraylogAPI interface {
+
+	// Test checks that the API is reachable and the credentials are valid
+	Test(ctx context.Context) error
+
+	// BaseURL returns the URL of the API, without a trailing slash
+	BaseURL() string
+
+	// ServerVersion returns the version of Graylog, the calls are adapted to it
+	ServerVersion(ctx context.Context) (*ServerVersion, error)
+
+	// ListClusterNodes returns the nodes of the Graylog cluster
+	ListClusterNodes(ctx context.Context) ([]ClusterNode, error)
+
+	// users
+	GetUserByName(ctx context.Context, username string) (*User, error)
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, id string, update *UserUpdate) error
+	DeleteUser(ctx context.Context, id string) error
+	SetUserPassword(ctx context.Context, id, password string) error
+	ListUserTokens(ctx context.Context, userID string) ([]Token, error)
+	CreateUserToken(ctx context.Context, userID, name string) (*Token, error)
+	DeleteUserToken(ctx context.Context, userID, tokenID string) error
+
+	// index sets
+	ListIndexSets(ctx context.Context) ([]IndexSet, error)
+	GetIndexSet(ctx context.Context, id string) (IndexSet, error)
+	CreateIndexSet(ctx context.Context, indexSet IndexSet) (string, error)
+	UpdateIndexSet(ctx context.Context, id string, indexSet IndexSet) error
+	DeleteIndexSet(ctx context.Context, id string) error
+	GetIndexSetStats(ctx context.Context, id string) (*IndexSetStats, error)
+	ListIndexRanges(ctx context.Context) ([]IndexRange, error)
+
+	// streams
+	ListStreams(ctx context.Context) ([]Stream, error)
+	GetStream(ctx context.Context, id string) (*Stream, error)
+	CreateStream(ctx context.Context, stream *Stream) (string, error)
+	UpdateStream(ctx context.Context, id string, update *StreamUpdate) error
+	DeleteStream(ctx context.Context, id string) error
+	ResumeStream(ctx context.Context, id string) error
+	AddStreamRule(ctx context.Context, streamID string, rule *StreamRule) error
+	UpdateStreamRule(ctx context.Context, streamID string, rule *StreamRule) error
+	DeleteStreamRule(ctx context.Context, streamID, ruleID string) error
+	GetStreamThroughput(ctx context.Context, id string) (int64, error)
+
+	// shares
+	ShareStream(ctx context.Context, streamID, userID string) error
+
+	// system
+	ListInputs(ctx context.Context) ([]Input, error)
+	SearchStream(ctx context.Context, streamID, query string, timeRange time.Duration, limit int, fields []string) ([]map[string]interface{}, error)
+}
+
+// User represents a user in the Graylog API
+type User struct {
+
+	// a unique user name used to log in with.
+	// ex. "local:admin"
+	Username string `json:"username,omitempty"`
+	// the contact email address
+	Email string `json:"email,omitempty"`
+	// a descriptive name for this account, e.g. the full name.
+	LastName  string `json:"last_name,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	// the name before Graylog 4.1, which has no first and last name
+	FullName string `json:"full_name,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	ID string `json:"id,omitempty"`
+
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserUpdate contains the updateable fields of a user, empty fields are not changed
+type UserUpdate struct {
+	Email string   `json:"email,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Token represents an access token of a user in the Graylog API.
+// The token itself is only returned on creation.
+type Token struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Token string `json:"token,omitempty"`
+}
+
+// IndexSet contains the raw json of an indexset, as indexsets are cloned and compared by their fields
+type IndexSet map[string]interface{}
+
+// ID returns the id of the indexset
+func (indexSet IndexSet) ID() string {
+	id, _ := indexSet["id"].(string)
+	return id
+}
+
+// Title returns the title of the indexset
+func (indexSet IndexSet) Title() string {
+	title, _ := indexSet["title"].(string)
+	return title
+}
+
+type IndexSetStats struct {
+	Indices   int64 `json:"indices"`
+	Documents int64 `json:"documents"`
+	Size      int64 `json:"size"`
+}
+
+type IndexRange struct {
+	IndexName string    `json:"index_name"`
+	Begin     time.Time `json:"begin"`
+}
+
+// StreamRule represents a stream rule.
+type StreamRule struct {
+	ID          string `json:"id,omitempty"`
+	StreamID    string `json:"stream_id,omitempty"`
+	Field       string `json:"field,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        int    `json:"type,omitempty"`
+	Inverted    bool   `json:"inverted,omitempty"`
+}
+
+type Stream struct {
+	Id                             string       `json:"id,omitempty"`
+	Title                          string       `json:"title"`
+	Description                    string       `json:"description"`
+	Rules                          []StreamRule `json:"rules"`
+	MatchingType                   string       `json:"matching_type,omitempty"`
+	RemoveMatchesFromDefaultStream bool         `json:"remove_matches_from_default_stream"`
+	IndexSetID                     string       `json:"index_set_id"`
+	Disabled                       bool         `json:"disabled,omitempty"`
+}
+
+// StreamUpdate contains the updateable fields of a stream, rules are maintained by their own endpoints
+type StreamUpdate struct {
+	Title                          string `json:"title"`
+	Description                    string `json:"description"`
+	MatchingType                   string `json:"matching_type,omitempty"`
+	RemoveMatchesFromDefaultStream bool   `json:"remove_matches_from_default_stream"`
+	IndexSetID                     string `json:"index_set_id"`
+}
+
+// Input represents an input of Graylog
+type Input struct {
+	ID         string                 `json:"id"`
+	Title      string                 `json:"title"`
+	Type       string                 `json:"type"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
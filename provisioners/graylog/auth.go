@@ -0,0 +1,160 @@
+package graylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// the modes to authenticate the operator at the Graylog API
+const (
+	// AUTH_MODE_BASIC sends the user and password with every request
+	AUTH_MODE_BASIC = "basic"
+
+	// AUTH_MODE_TOKEN sends an access token as the user, with the password "token"
+	AUTH_MODE_TOKEN = "token"
+
+	// AUTH_MODE_SESSION logs in with the user and password, and sends the session id with every request
+	AUTH_MODE_SESSION = "session"
+)
+
+// sessions are renewed before they expire, to avoid failing requests
+const sessionRenewBefore = time.Minute
+
+// authenticator sets the credentials of a request to the Graylog API
+type authenticator interface {
+	authorize(ctx context.Context, req *http.Request) error
+
+	// renew discards the credentials after the API responded with 401,
+	// and returns true if the request should be repeated with new credentials
+	renew() bool
+}
+
+func newAuthenticator(client *GraylogClient) (authenticator, error) {
+
+	config := client.config
+
+	switch config.AuthMode {
+	case "", AUTH_MODE_BASIC:
+		return &basicAuth{user: config.User, password: config.Password}, nil
+	case AUTH_MODE_TOKEN:
+		return &basicAuth{user: config.Token, password: "token"}, nil
+	case AUTH_MODE_SESSION:
+		return &sessionAuth{client: client}, nil
+	default:
+		return nil, errors.Errorf("Unknown auth mode '%s'", config.AuthMode)
+	}
+}
+
+type basicAuth struct {
+	user, password string
+}
+
+func (auth *basicAuth) authorize(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth(auth.user, auth.password)
+	return nil
+}
+
+func (auth *basicAuth) renew() bool {
+	return false
+}
+
+// sessionAuth logs in through /api/system/sessions, and logs in again before the session expires
+type sessionAuth struct {
+	client *GraylogClient
+
+	mu         sync.Mutex
+	sessionID  string
+	validUntil time.Time
+}
+
+func (auth *sessionAuth) authorize(ctx context.Context, req *http.Request) error {
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	expiring := !auth.validUntil.IsZero() && time.Now().Add(sessionRenewBefore).After(auth.validUntil)
+	if auth.sessionID == "" || expiring {
+		if err := auth.login(ctx); err != nil {
+			return err
+		}
+	}
+
+	req.SetBasicAuth(auth.sessionID, "session")
+	return nil
+}
+
+func (auth *sessionAuth) renew() bool {
+
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.sessionID = ""
+	return true
+}
+
+func (auth *sessionAuth) login(ctx context.Context) error {
+
+	config := auth.client.config
+
+	body, err := json.Marshal(map[string]string{
+		"username": config.User,
+		"password": config.Password,
+		"host":     "",
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode session request")
+	}
+
+	req, err := http.NewRequest("POST", config.Url+"/api/system/sessions", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to call http.NewRequest")
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Requested-By", "wd-k8s-operator")
+
+	resp, err := auth.client.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to create session")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return errors.Wrap(&APIError{Method: "POST", Endpoint: "/api/system/sessions", StatusCode: resp.StatusCode}, "failed to create session")
+	}
+
+	session := struct {
+		SessionID  string `json:"session_id"`
+		ValidUntil string `json:"valid_until"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return errors.Wrap(err, "failed to decode session response")
+	}
+
+	if session.SessionID == "" {
+		return errors.New("no session id returned by Graylog")
+	}
+
+	// if the expiry can't be read, the session is only renewed after the API responded with 401
+	auth.sessionID = session.SessionID
+	auth.validUntil = time.Time{}
+	for _, layout := range sessionTimestampLayouts {
+		if t, err := time.Parse(layout, session.ValidUntil); err == nil {
+			auth.validUntil = t
+			break
+		}
+	}
+
+	auth.client.Log.V(1).Info("Graylog session created", "validUntil", session.ValidUntil)
+	return nil
+}
+
+// layouts of the valid_until timestamp of a session
+var sessionTimestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700"}
@@ -0,0 +1,56 @@
+package graylog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionAuthRenewsExpiredSession(t *testing.T) {
+
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/system/sessions" {
+			logins++
+			fmt.Fprintf(w, `{"session_id": "session-%d", "valid_until": "2099-01-01T00:00:00.000+0000"}`, logins)
+			return
+		}
+
+		// the first session expires after it has been created
+		user, password, _ := r.BasicAuth()
+		if user != "session-2" || password != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := testClient(t, ClientConfig{Url: server.URL, AuthMode: AUTH_MODE_SESSION, User: "admin", Password: "secret"})
+	if err := client.Test(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if logins != 2 {
+		t.Errorf("expected 2 logins, got %d", logins)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "abc" || password != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := testClient(t, ClientConfig{Url: server.URL, AuthMode: AUTH_MODE_TOKEN, Token: "abc"})
+	if err := client.Test(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
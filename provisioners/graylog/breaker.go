@@ -0,0 +1,135 @@
+package graylog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// default settings of the circuit breaker
+const (
+	DEFAULT_BREAKER_FAILURE_THRESHOLD = 5
+	DEFAULT_BREAKER_OPEN_DURATION     = 30 * time.Second
+)
+
+// the states of the circuit breaker
+const (
+	CIRCUIT_CLOSED    = "closed"
+	CIRCUIT_OPEN      = "open"
+	CIRCUIT_HALF_OPEN = "half-open"
+)
+
+// CircuitOpenError is returned without calling Graylog, while the circuit breaker is open
+type CircuitOpenError struct {
+	Failures int
+	Until    time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Graylog calls suspended after %d consecutive failures, retrying after %s", e.Failures, e.Until.Format(time.RFC3339))
+}
+
+// IsCircuitOpen returns true if err has been returned because the circuit breaker is open
+func IsCircuitOpen(err error) bool {
+	var circuitErr *CircuitOpenError
+	return errors.As(err, &circuitErr)
+}
+
+// circuitBreaker suspends the calls to Graylog after consecutive transient failures, to not overload it further.
+// After openDuration a single call is let through, and the breaker is closed again if it succeeds.
+type circuitBreaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(failureThreshold int, openDuration time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		state:            CIRCUIT_CLOSED,
+	}
+}
+
+// allow returns an error if the call must not be executed
+func (b *circuitBreaker) allow() error {
+
+	if b.failureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CIRCUIT_OPEN:
+		if time.Now().Before(b.openUntil) {
+			return &CircuitOpenError{Failures: b.failures, Until: b.openUntil}
+		}
+		b.state = CIRCUIT_HALF_OPEN
+		b.probing = true
+		return nil
+
+	case CIRCUIT_HALF_OPEN:
+		// only one probe at a time, the others wait for its result
+		if b.probing {
+			return &CircuitOpenError{Failures: b.failures, Until: b.openUntil}
+		}
+		b.probing = true
+		return nil
+
+	default:
+		return nil
+	}
+}
+
+// record updates the state with the result of an allowed call, and returns true if the state changed
+func (b *circuitBreaker) record(failed bool) (string, bool) {
+
+	if b.failureThreshold <= 0 {
+		return CIRCUIT_CLOSED, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	previous := b.state
+	b.probing = false
+
+	if !failed {
+		b.state = CIRCUIT_CLOSED
+		b.failures = 0
+		return b.state, b.state != previous
+	}
+
+	b.failures++
+	if b.state == CIRCUIT_HALF_OPEN || b.failures >= b.failureThreshold {
+		b.state = CIRCUIT_OPEN
+		b.openUntil = time.Now().Add(b.openDuration)
+	}
+
+	return b.state, b.state != previous
+}
+
+// release ends an allowed call without a result, e.g. if it has been canceled
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns the current state of the breaker
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
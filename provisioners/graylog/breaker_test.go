@@ -0,0 +1,52 @@
+package graylog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+
+	healthy := false
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !healthy {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := testClient(t, ClientConfig{Url: server.URL, BreakerFailureThreshold: 3, BreakerOpenDuration: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	// the retries of the first call open the breaker
+	if err := client.Test(ctx); err == nil || IsCircuitOpen(err) {
+		t.Fatalf("expected the failure of Graylog, got %v", err)
+	}
+
+	if err := client.Test(ctx); !IsCircuitOpen(err) {
+		t.Fatalf("expected an open circuit, got %v", err)
+	}
+
+	if calls != 3 || client.CircuitState() != CIRCUIT_OPEN {
+		t.Errorf("unexpected %d calls in state %s", calls, client.CircuitState())
+	}
+
+	// the half-open probe closes the breaker again
+	healthy = true
+	time.Sleep(60 * time.Millisecond)
+
+	if err := client.Test(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.CircuitState() != CIRCUIT_CLOSED {
+		t.Errorf("unexpected state %s", client.CircuitState())
+	}
+}
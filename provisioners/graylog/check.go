@@ -0,0 +1,84 @@
+package graylog
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+)
+
+// ObjectCheck is the result of checking a provisioned object in Graylog
+type ObjectCheck struct {
+	Kind string
+	ID   string
+
+	// Exists is set if the object was found by its ID
+	Exists bool
+
+	// Owned is set if the object carries the ownership marker of the LoggingSetup
+	Owned bool
+
+	// Marker is the description (or email) found on the object
+	Marker string
+}
+
+// CheckObjects verifies that the objects in data exist in Graylog and carry the ownership marker.
+// Objects without an ID are skipped.
+func CheckObjects(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData) ([]ObjectCheck, error) {
+
+	var (
+		checks []ObjectCheck
+	)
+
+	if data.User.ID != "" {
+		check := ObjectCheck{Kind: "User", ID: data.User.ID}
+
+		user, err := api.GetUserByID(ctx, data.User.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if user != nil {
+			check.Exists = true
+			check.Marker = user.Email
+			check.Owned = data.owns(user.Email)
+		}
+
+		checks = append(checks, check)
+	}
+
+	if data.IndexSet.ID != "" {
+		check := ObjectCheck{Kind: "IndexSet", ID: data.IndexSet.ID}
+
+		indexSet, err := api.GetIndexSet(ctx, data.IndexSet.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if indexSet != nil {
+			check.Exists = true
+			check.Marker, _ = indexSet["description"].(string)
+			check.Owned = data.owns(check.Marker)
+		}
+
+		checks = append(checks, check)
+	}
+
+	if data.Stream.ID != "" {
+		check := ObjectCheck{Kind: "Stream", ID: data.Stream.ID}
+
+		stream, err := api.GetStream(ctx, data.Stream.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if stream != nil {
+			check.Exists = true
+			check.Marker = stream.Description
+			check.Owned = data.owns(stream.Description)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,820 @@
+package graylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// ClientConfig contains the connection settings of the Graylog API
+type ClientConfig struct {
+	Url string
+
+	// AuthMode is one of AUTH_MODE_BASIC, AUTH_MODE_TOKEN or AUTH_MODE_SESSION, basic if empty
+	AuthMode string
+
+	// User and Password are used by the basic and session modes
+	User     string
+	Password string
+
+	// Token is the access token used by the token mode
+	Token string
+
+	// Timeout limits a single request including reading the response, 0 means no timeout
+	Timeout time.Duration
+
+	// MaxIdleConns is the number of idle connections kept open for reuse
+	MaxIdleConns int
+
+	// IdleConnTimeout closes idle connections after this time
+	IdleConnTimeout time.Duration
+
+	// MaxRetries is the number of retries of a call failing transiently, 0 disables retries
+	MaxRetries int
+
+	// RetryInitialBackoff is the delay before the first retry, it is doubled for every further retry
+	RetryInitialBackoff time.Duration
+
+	// RetryMaxBackoff caps the delay between retries
+	RetryMaxBackoff time.Duration
+
+	// QPS is the number of requests per second sent to Graylog, 0 disables the rate limit
+	QPS float32
+
+	// Burst is the number of requests which may exceed the QPS at once
+	Burst int
+
+	// BreakerFailureThreshold is the number of consecutive failures opening the circuit breaker, 0 disables it
+	BreakerFailureThreshold int
+
+	// BreakerOpenDuration is the time calls are suspended, before a single call probes Graylog again
+	BreakerOpenDuration time.Duration
+
+	// ObserveRequest is called after every request if set, e.g. to record metrics
+	ObserveRequest RequestObserver
+
+	TLS TLSConfig
+}
+
+// default settings of the connection pool
+const (
+	DEFAULT_TIMEOUT           = 30 * time.Second
+	DEFAULT_MAX_IDLE_CONNS    = 10
+	DEFAULT_IDLE_CONN_TIMEOUT = 90 * time.Second
+)
+
+// GraylogClient implements GraylogAPI. It is safe for concurrent use,
+// and should be shared, so that the connections are reused.
+type GraylogClient struct {
+	config  ClientConfig
+	http    *http.Client
+	limiter flowcontrol.RateLimiter
+	breaker *circuitBreaker
+	auth    authenticator
+	Log     logr.Logger
+
+	// the version is detected by the first call needing it
+	versionMu   sync.Mutex
+	version     *ServerVersion
+	lastVersion string
+}
+
+var _ GraylogAPI = &GraylogClient{}
+
+// returns a ClientConfig with the default pool, retry and rate limit settings.
+// Reads GRAYLOG_URL, GRAYLOG_AUTH_MODE and the credentials of the mode:
+// GRAYLOG_USER and GRAYLOG_PASSWORD for basic and session, GRAYLOG_TOKEN for token.
+// Reads the optional GRAYLOG_CA_FILE, GRAYLOG_CLIENT_CERT_FILE, GRAYLOG_CLIENT_KEY_FILE,
+// GRAYLOG_TLS_SERVER_NAME and GRAYLOG_TLS_INSECURE for the TLS settings
+func ConfigFromEnv() (ClientConfig, error) {
+
+	config := ClientConfig{
+		Url:             strings.TrimSuffix(os.Getenv("GRAYLOG_URL"), "/"),
+		AuthMode:        os.Getenv("GRAYLOG_AUTH_MODE"),
+		User:            os.Getenv("GRAYLOG_USER"),
+		Password:        os.Getenv("GRAYLOG_PASSWORD"),
+		Token:           os.Getenv("GRAYLOG_TOKEN"),
+		Timeout:         DEFAULT_TIMEOUT,
+		MaxIdleConns:    DEFAULT_MAX_IDLE_CONNS,
+		IdleConnTimeout: DEFAULT_IDLE_CONN_TIMEOUT,
+
+		MaxRetries:          DEFAULT_MAX_RETRIES,
+		RetryInitialBackoff: DEFAULT_RETRY_INITIAL_BACKOFF,
+		RetryMaxBackoff:     DEFAULT_RETRY_MAX_BACKOFF,
+		QPS:                 DEFAULT_QPS,
+		Burst:               DEFAULT_BURST,
+
+		BreakerFailureThreshold: DEFAULT_BREAKER_FAILURE_THRESHOLD,
+		BreakerOpenDuration:     DEFAULT_BREAKER_OPEN_DURATION,
+
+		TLS: TLSConfig{
+			CAFile:     os.Getenv("GRAYLOG_CA_FILE"),
+			CertFile:   os.Getenv("GRAYLOG_CLIENT_CERT_FILE"),
+			KeyFile:    os.Getenv("GRAYLOG_CLIENT_KEY_FILE"),
+			ServerName: os.Getenv("GRAYLOG_TLS_SERVER_NAME"),
+		},
+	}
+
+	if insecure := os.Getenv("GRAYLOG_TLS_INSECURE"); insecure != "" {
+		value, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return config, errors.Wrap(err, "Invalid GRAYLOG_TLS_INSECURE enviornment variable")
+		}
+		config.TLS.InsecureSkipVerify = value
+	}
+
+	if err := config.TLS.validate(); err != nil {
+		return config, err
+	}
+
+	if config.Url == "" {
+		return config, errors.New("Missing GRAYLOG_URL enviornment variable")
+	}
+
+	switch config.AuthMode {
+	case "", AUTH_MODE_BASIC, AUTH_MODE_SESSION:
+		if config.User == "" {
+			return config, errors.New("Missing GRAYLOG_USER enviornment variable")
+		}
+
+		if config.Password == "" {
+			return config, errors.New("Missing GRAYLOG_PASSWORD enviornment variable")
+		}
+
+	case AUTH_MODE_TOKEN:
+		if config.Token == "" {
+			return config, errors.New("Missing GRAYLOG_TOKEN enviornment variable")
+		}
+
+	default:
+		return config, errors.Errorf("Invalid GRAYLOG_AUTH_MODE '%s', expected %s, %s or %s", config.AuthMode, AUTH_MODE_BASIC, AUTH_MODE_TOKEN, AUTH_MODE_SESSION)
+	}
+
+	return config, nil
+}
+
+// returns a Client with a connection pool for the config
+func NewClient(config ClientConfig, log logr.Logger) (*GraylogClient, error) {
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConns,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	limiter := flowcontrol.NewFakeAlwaysRateLimiter()
+	if config.QPS > 0 {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(config.QPS, config.Burst)
+	}
+
+	client := &GraylogClient{
+		config: config,
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+		},
+		limiter: limiter,
+		breaker: newCircuitBreaker(config.BreakerFailureThreshold, config.BreakerOpenDuration),
+		Log:     log,
+	}
+
+	// the TLS files are read for new connections, so that changes are applied without a restart
+	if config.TLS.enabled() {
+		loader := newTLSLoader(config.TLS)
+		loader.onReload = func() {
+			transport.CloseIdleConnections()
+			client.invalidateVersion()
+		}
+		transport.DialTLSContext = loader.dialTLS(dialer, transport.TLSHandshakeTimeout)
+	}
+
+	auth, err := newAuthenticator(client)
+	if err != nil {
+		return nil, err
+	}
+	client.auth = auth
+
+	return client, nil
+}
+
+func (client *GraylogClient) BaseURL() string {
+	return client.config.Url
+}
+
+func (client *GraylogClient) Test(ctx context.Context) error {
+	return client.callAPIExpect(ctx, "GET", "/api/cluster", nil, nil, 200)
+}
+
+func (client *GraylogClient) ListClusterNodes(ctx context.Context) ([]ClusterNode, error) {
+	cluster := map[string]ClusterNode{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/cluster", nil, &cluster, 200)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]ClusterNode, 0, len(cluster))
+	for _, node := range cluster {
+		nodes = append(nodes, node)
+	}
+
+	// the cluster is a map by node id, so it is sorted for stable messages
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Hostname < nodes[j].Hostname })
+	return nodes, nil
+}
+
+func (client *GraylogClient) callAPIExpect(ctx context.Context, method, endpoint string, input, output interface{}, expectedStatusCode int) error {
+	sc, err := client.callAPI(ctx, method, endpoint, input, output)
+	if err != nil {
+		// no Wrap here, because we have the context information in callAPI
+		return err
+	}
+
+	if sc != expectedStatusCode {
+		return errors.Wrapf(&APIError{Method: method, Endpoint: endpoint, StatusCode: sc}, "%d expected", expectedStatusCode)
+	}
+
+	return nil
+}
+
+// calls a GET endpoint returning 404 for missing objects, and returns if the object has been found
+func (client *GraylogClient) callAPIGetOptional(ctx context.Context, endpoint string, output interface{}) (bool, error) {
+	sc, err := client.callAPI(ctx, "GET", endpoint, nil, output)
+
+	switch sc {
+	case 200:
+		// a body that can't be decoded must not be taken for an object with empty fields
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	case 404:
+		return false, nil
+	default:
+		if err == nil {
+			err = &APIError{Method: "GET", Endpoint: endpoint, StatusCode: sc}
+		}
+		return false, err
+	}
+}
+
+// calls a DELETE endpoint, a missing object is not an error
+func (client *GraylogClient) callAPIDelete(ctx context.Context, endpoint string) error {
+	sc, err := client.callAPI(ctx, "DELETE", endpoint, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if sc != 204 && sc != 404 {
+		return &APIError{Method: "DELETE", Endpoint: endpoint, StatusCode: sc}
+	}
+
+	return nil
+}
+
+// callAPI executes the request, and retries it with a capped exponential backoff if it fails transiently.
+// Returns the status code of the last attempt.
+func (client *GraylogClient) callAPI(ctx context.Context, method, endpoint string, input, output interface{}) (int, error) {
+
+	log := client.Log.WithValues("method", method, "endpoint", endpoint)
+
+	// build request body once, it is sent again by every retry
+	var reqBody []byte
+	if input != nil {
+		buf := &bytes.Buffer{}
+		if err := json.NewEncoder(buf).Encode(input); err != nil {
+			return 0, errors.Wrap(err, "failed to encode request body")
+		}
+		reqBody = buf.Bytes()
+	}
+
+	renewed := false
+	for attempt := 0; ; attempt++ {
+
+		if err := client.limiter.Wait(ctx); err != nil {
+			return 0, errors.Wrap(err, "rate limit of the Graylog API")
+		}
+
+		if err := client.breaker.allow(); err != nil {
+			return 0, err
+		}
+
+		start := time.Now()
+		sc, resp, err := client.callAPIOnce(ctx, log, method, endpoint, reqBody, output)
+		client.recordResult(sc, err)
+
+		if client.config.ObserveRequest != nil {
+			client.config.ObserveRequest(method, endpointTemplate(endpoint), sc, time.Since(start))
+		}
+
+		// Graylog may have been restarted with another version, if the connection failed
+		if err != nil && sc == 0 {
+			client.invalidateVersion()
+		}
+
+		// an expired session is renewed once, without counting as a retry
+		if sc == http.StatusUnauthorized && !renewed && client.auth.renew() {
+			log.V(1).Info("Renew Graylog session")
+			client.invalidateVersion()
+			renewed = true
+			attempt--
+			continue
+		}
+
+		if attempt >= client.config.MaxRetries || !shouldRetry(method, sc, err) {
+			return sc, err
+		}
+
+		backoff := client.config.retryBackoff(attempt, resp)
+		log.V(1).Info("Retry GrayLogAPICall", "attempt", attempt+1, "StatusCode", sc, "error", err, "backoff", backoff)
+
+		if err := sleep(ctx, backoff); err != nil {
+			return sc, errors.Wrap(err, "retry of the Graylog API call")
+		}
+	}
+}
+
+// recordResult updates the circuit breaker with the result of an attempt
+func (client *GraylogClient) recordResult(sc int, err error) {
+
+	if errors.Is(err, context.Canceled) {
+		client.breaker.release()
+		return
+	}
+
+	failed := IsTransient(err) || isTransientStatus(sc)
+	if state, changed := client.breaker.record(failed); changed {
+		client.Log.Info("Graylog circuit breaker changed", "state", state)
+	}
+}
+
+// CircuitState returns the state of the circuit breaker, one of CIRCUIT_CLOSED, CIRCUIT_OPEN or CIRCUIT_HALF_OPEN
+func (client *GraylogClient) CircuitState() string {
+	return client.breaker.State()
+}
+
+// callAPIOnce executes a single attempt of the request, the response is returned for its headers only
+func (client *GraylogClient) callAPIOnce(ctx context.Context, log logr.Logger, method, endpoint string, reqBody []byte, output interface{}) (int, *http.Response, error) {
+
+	// make URL
+	url := client.config.Url + endpoint
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to call http.NewRequest")
+	}
+
+	req = req.WithContext(ctx)
+
+	if err := client.auth.authorize(ctx, req); err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Requested-By", "wd-k8s-operator")
+
+	// request
+	resp, err := client.http.Do(req)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to execute http request")
+	}
+
+	defer resp.Body.Close()
+
+	// read response to buffer so that we can log the body an decode the output
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, resp, errors.Wrap(err, "failed to read response body")
+	}
+
+	log.V(2).Info("GrayLogAPICall", "StatusCode", resp.StatusCode, "Body", string(responseBody))
+
+	// error responses don't match the output
+	if output != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(bytes.NewReader(responseBody)).Decode(output); err != nil {
+			return resp.StatusCode, resp, errors.Wrap(err, "failed to decode graylog API response body")
+		}
+	}
+
+	return resp.StatusCode, resp, nil
+}
+
+// users
+
+func (client *GraylogClient) GetUserByName(ctx context.Context, username string) (*User, error) {
+	user := &User{}
+	found, err := client.callAPIGetOptional(ctx, "/api/users/"+username, user)
+	if !found {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (client *GraylogClient) GetUserByID(ctx context.Context, id string) (*User, error) {
+	user := &User{}
+	found, err := client.callAPIGetOptional(ctx, "/api/users/id/"+id, user)
+	if !found {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (client *GraylogClient) CreateUser(ctx context.Context, user *User) error {
+
+	version, err := client.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !version.SupportsSplitUserName() {
+		legacy := *user
+		legacy.FullName = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		legacy.FirstName, legacy.LastName = "", ""
+		user = &legacy
+	}
+
+	return client.callAPIExpect(ctx, "POST", "/api/users", user, nil, 201)
+}
+
+// userPath returns the path of the user endpoints, which take the username before Graylog 4
+func (client *GraylogClient) userPath(ctx context.Context, id string) (string, error) {
+
+	version, err := client.ServerVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if version.AddressesUsersByID() {
+		return "/api/users/" + id, nil
+	}
+
+	user, err := client.GetUserByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", &APIError{Method: "GET", Endpoint: "/api/users/id/" + id, StatusCode: 404}
+	}
+
+	return "/api/users/" + url.PathEscape(user.Username), nil
+}
+
+func (client *GraylogClient) UpdateUser(ctx context.Context, id string, update *UserUpdate) error {
+	path, err := client.userPath(ctx, id)
+	if err != nil {
+		return err
+	}
+	return client.callAPIExpect(ctx, "PUT", path, update, nil, 204)
+}
+
+// DeleteUser deletes the user, Graylog 4 has a separate endpoint to delete users by ID
+func (client *GraylogClient) DeleteUser(ctx context.Context, id string) error {
+	version, err := client.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if version.AddressesUsersByID() {
+		return client.callAPIDelete(ctx, "/api/users/id/"+id)
+	}
+
+	path, err := client.userPath(ctx, id)
+	if err != nil {
+		// the user is already deleted, if the username can't be looked up
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return client.callAPIDelete(ctx, path)
+}
+
+// isNotFound returns true if err has been returned for a missing object
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == 404
+}
+
+// SetUserPassword sets a new password for the user, the old password is not needed with admin permissions
+func (client *GraylogClient) SetUserPassword(ctx context.Context, id, password string) error {
+	request := struct {
+		Password string `json:"password"`
+	}{password}
+
+	path, err := client.userPath(ctx, id)
+	if err != nil {
+		return err
+	}
+	return client.callAPIExpect(ctx, "PUT", path+"/password", request, nil, 204)
+}
+
+func (client *GraylogClient) ListUserTokens(ctx context.Context, userID string) ([]Token, error) {
+	path, err := client.userPath(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := struct {
+		Tokens []Token `json:"tokens"`
+	}{}
+
+	err = client.callAPIExpect(ctx, "GET", path+"/tokens", nil, &tokens, 200)
+	if err != nil {
+		return nil, err
+	}
+
+	// Graylog 3 doesn't return the ID, the tokens are revoked by their value instead
+	for i := range tokens.Tokens {
+		if tokens.Tokens[i].ID == "" {
+			tokens.Tokens[i].ID = tokens.Tokens[i].Token
+		}
+	}
+	return tokens.Tokens, nil
+}
+
+func (client *GraylogClient) CreateUserToken(ctx context.Context, userID, name string) (*Token, error) {
+	path, err := client.userPath(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{}
+	err = client.callAPIExpect(ctx, "POST", path+"/tokens/"+name, nil, token, 200)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (client *GraylogClient) DeleteUserToken(ctx context.Context, userID, tokenID string) error {
+	path, err := client.userPath(ctx, userID)
+	if err != nil {
+		// the tokens are deleted with the user
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return client.callAPIDelete(ctx, path+"/tokens/"+tokenID)
+}
+
+// index sets
+
+func (client *GraylogClient) ListIndexSets(ctx context.Context) ([]IndexSet, error) {
+	sets := struct {
+		IndexSets []IndexSet `json:"index_sets"`
+		Total     int        `json:"total"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/system/indices/index_sets", nil, &sets, 200)
+	if err != nil {
+		return nil, err
+	}
+	return sets.IndexSets, nil
+}
+
+func (client *GraylogClient) GetIndexSet(ctx context.Context, id string) (IndexSet, error) {
+	indexSet := IndexSet{}
+	found, err := client.callAPIGetOptional(ctx, "/api/system/indices/index_sets/"+id, &indexSet)
+	if !found {
+		return nil, err
+	}
+	return indexSet, nil
+}
+
+func (client *GraylogClient) CreateIndexSet(ctx context.Context, indexSet IndexSet) (string, error) {
+	created := IndexSet{}
+	err := client.callAPIExpect(ctx, "POST", "/api/system/indices/index_sets", indexSet, &created, 200)
+	if err != nil {
+		return "", err
+	}
+	return created.ID(), nil
+}
+
+func (client *GraylogClient) UpdateIndexSet(ctx context.Context, id string, indexSet IndexSet) error {
+	return client.callAPIExpect(ctx, "PUT", "/api/system/indices/index_sets/"+id, indexSet, nil, 200)
+}
+
+func (client *GraylogClient) DeleteIndexSet(ctx context.Context, id string) error {
+	return client.callAPIDelete(ctx, "/api/system/indices/index_sets/"+id)
+}
+
+func (client *GraylogClient) GetIndexSetStats(ctx context.Context, id string) (*IndexSetStats, error) {
+	stats := &IndexSetStats{}
+	err := client.callAPIExpect(ctx, "GET", "/api/system/indices/index_sets/"+id+"/stats", nil, stats, 200)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (client *GraylogClient) ListIndexRanges(ctx context.Context) ([]IndexRange, error) {
+	ranges := struct {
+		Ranges []IndexRange `json:"ranges"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/system/indices/ranges", nil, &ranges, 200)
+	if err != nil {
+		return nil, err
+	}
+	return ranges.Ranges, nil
+}
+
+// streams
+
+func (client *GraylogClient) ListStreams(ctx context.Context) ([]Stream, error) {
+	streams := struct {
+		Streams []Stream `json:"streams"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/streams", nil, &streams, 200)
+	if err != nil {
+		return nil, err
+	}
+	return streams.Streams, nil
+}
+
+func (client *GraylogClient) GetStream(ctx context.Context, id string) (*Stream, error) {
+	stream := &Stream{}
+	found, err := client.callAPIGetOptional(ctx, "/api/streams/"+id, stream)
+	if !found {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (client *GraylogClient) CreateStream(ctx context.Context, stream *Stream) (string, error) {
+	response := struct {
+		StreamId string `json:"stream_id"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "POST", "/api/streams", stream, &response, 201)
+	if err != nil {
+		return "", err
+	}
+	return response.StreamId, nil
+}
+
+func (client *GraylogClient) UpdateStream(ctx context.Context, id string, update *StreamUpdate) error {
+	return client.callAPIExpect(ctx, "PUT", "/api/streams/"+id, update, nil, 200)
+}
+
+func (client *GraylogClient) DeleteStream(ctx context.Context, id string) error {
+	return client.callAPIDelete(ctx, "/api/streams/"+id)
+}
+
+func (client *GraylogClient) ResumeStream(ctx context.Context, id string) error {
+	return client.callAPIExpect(ctx, "POST", "/api/streams/"+id+"/resume", nil, nil, 204)
+}
+
+func (client *GraylogClient) AddStreamRule(ctx context.Context, streamID string, rule *StreamRule) error {
+	return client.callAPIExpect(ctx, "POST", "/api/streams/"+streamID+"/rules", rule, nil, 201)
+}
+
+func (client *GraylogClient) UpdateStreamRule(ctx context.Context, streamID string, rule *StreamRule) error {
+	return client.callAPIExpect(ctx, "PUT", "/api/streams/"+streamID+"/rules/"+rule.ID, rule, nil, 200)
+}
+
+func (client *GraylogClient) DeleteStreamRule(ctx context.Context, streamID, ruleID string) error {
+	return client.callAPIExpect(ctx, "DELETE", "/api/streams/"+streamID+"/rules/"+ruleID, nil, nil, 204)
+}
+
+func (client *GraylogClient) GetStreamThroughput(ctx context.Context, id string) (int64, error) {
+	throughput := struct {
+		Throughput int64 `json:"throughput"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/streams/"+id+"/throughput", nil, &throughput, 200)
+	if err != nil {
+		return 0, err
+	}
+	return throughput.Throughput, nil
+}
+
+// shares
+
+func (client *GraylogClient) ShareStream(ctx context.Context, streamID, userID string) error {
+
+	/* By inspecting the Rest Calls from the Graylog UI, we see the following POST call executed:
+
+	First there is a POST call to $GRAYLOG/api/authz/shares/entities/grn::::stream:60a242439e82ee1814ce2cd5/prepare, but it seems to be not
+	mandatory, as we can create shares successfully with curl without `/prepare`.
+
+	This is the call on "Save":
+	curl "$GRAYLOG/api/authz/shares/entities/grn::::stream:60a242439e82ee1814ce2cd5" \
+		  --data-raw '{"selected_grantee_capabilities":{"grn::::user:60a226a99e82ee1814ce0e92":"view"}}'
+
+	60a242439e82ee1814ce2cd5 is the ID of the Stream
+	60a226a99e82ee1814ce0e92 is the ID of the User
+
+	*/
+
+	version, err := client.ServerVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !version.SupportsEntityShares() {
+		return client.grantStreamPermission(ctx, streamID, userID)
+	}
+
+	grn := "grn::::stream:" + streamID
+
+	share_request := struct {
+		Selected_grantee_capabilities map[string]interface{} `json:"selected_grantee_capabilities,omitempty"`
+	}{map[string]interface{}{
+		"grn::::user:" + userID: "view",
+	}}
+
+	return client.callAPIExpect(ctx, "POST", "/api/authz/shares/entities/"+grn, share_request, nil, 200)
+}
+
+// grantStreamPermission gives the user read access to the stream by its permissions, as Graylog 3 has no shares
+func (client *GraylogClient) grantStreamPermission(ctx context.Context, streamID, userID string) error {
+
+	user, err := client.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return &APIError{Method: "GET", Endpoint: "/api/users/id/" + userID, StatusCode: 404}
+	}
+
+	permission := "streams:read:" + streamID
+	for _, p := range user.Permissions {
+		if p == permission {
+			return nil
+		}
+	}
+
+	request := struct {
+		Permissions []string `json:"permissions"`
+	}{append(append([]string{}, user.Permissions...), permission)}
+
+	return client.callAPIExpect(ctx, "PUT", "/api/users/"+url.PathEscape(user.Username)+"/permissions", request, nil, 204)
+}
+
+// system
+
+func (client *GraylogClient) ListInputs(ctx context.Context) ([]Input, error) {
+	inputs := struct {
+		Inputs []Input `json:"inputs"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/system/inputs", nil, &inputs, 200)
+	if err != nil {
+		return nil, err
+	}
+	return inputs.Inputs, nil
+}
+
+// SearchStream searches the messages of the stream within the last timeRange, and returns the given fields
+func (client *GraylogClient) SearchStream(ctx context.Context, streamID, query string, timeRange time.Duration, limit int, fields []string) ([]map[string]interface{}, error) {
+
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("range", fmt.Sprint(int64(timeRange/time.Second)))
+	values.Set("filter", "streams:"+streamID)
+	values.Set("limit", fmt.Sprint(limit))
+	values.Set("fields", strings.Join(fields, ","))
+
+	result := struct {
+		Messages []struct {
+			Message map[string]interface{} `json:"message"`
+		} `json:"messages"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/search/universal/relative?"+values.Encode(), nil, &result, 200)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]map[string]interface{}, 0, len(result.Messages))
+	for _, m := range result.Messages {
+		messages = append(messages, m.Message)
+	}
+	return messages, nil
+}
@@ -0,0 +1,45 @@
+package graylog
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ClusterNode is a node of the Graylog cluster, as returned by /api/cluster
+type ClusterNode struct {
+	NodeID       string `json:"node_id"`
+	Hostname     string `json:"hostname"`
+	Lifecycle    string `json:"lifecycle"`
+	LBStatus     string `json:"lb_status"`
+	IsProcessing bool   `json:"is_processing"`
+}
+
+// healthy returns true if the node processes messages and is alive for the load balancer
+func (node *ClusterNode) healthy() bool {
+	return node.IsProcessing && strings.EqualFold(node.LBStatus, "alive")
+}
+
+// CheckCluster returns an error if Graylog is not reachable, or none of its nodes is healthy
+func CheckCluster(ctx context.Context, api GraylogAPI) error {
+
+	nodes, err := api.ListClusterNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(nodes) == 0 {
+		return errors.New("Graylog reported no cluster nodes")
+	}
+
+	var unhealthy []string
+	for _, node := range nodes {
+		if node.healthy() {
+			return nil
+		}
+		unhealthy = append(unhealthy, node.Hostname+" ("+node.Lifecycle+", "+node.LBStatus+")")
+	}
+
+	return errors.Errorf("no healthy Graylog node: %s", strings.Join(unhealthy, ", "))
+}
@@ -0,0 +1,31 @@
+package graylog
+
+import (
+	"context"
+	"testing"
+)
+
+type fakeClusterAPI struct {
+	GraylogAPI
+	nodes []ClusterNode
+}
+
+func (api *fakeClusterAPI) ListClusterNodes(ctx context.Context) ([]ClusterNode, error) {
+	return api.nodes, nil
+}
+
+func TestCheckCluster(t *testing.T) {
+
+	api := &fakeClusterAPI{nodes: []ClusterNode{
+		{Hostname: "graylog-0", Lifecycle: "override_lb_dead", LBStatus: "dead", IsProcessing: true},
+	}}
+
+	if err := CheckCluster(context.Background(), api); err == nil {
+		t.Error("expected an error without a healthy node")
+	}
+
+	api.nodes = append(api.nodes, ClusterNode{Hostname: "graylog-1", Lifecycle: "running", LBStatus: "alive", IsProcessing: true})
+	if err := CheckCluster(context.Background(), api); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,102 @@
+package graylog
+
+import "reflect"
+
+// returns the items of desired not contained in actual
+func missingItems(actual, desired []string) []string {
+	var missing []string
+
+	for _, d := range desired {
+		found := false
+		for _, a := range actual {
+			if a == d {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, d)
+		}
+	}
+
+	return missing
+}
+
+// returns items without the ones contained in remove
+func removeItems(items, remove []string) []string {
+	kept := []string{}
+
+	for _, i := range items {
+		found := false
+		for _, r := range remove {
+			if i == r {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			kept = append(kept, i)
+		}
+	}
+
+	return kept
+}
+
+// compares the given fields of the raw json objects and returns the differing ones.
+// Values are compared after decoding, so numbers are always float64.
+func differingFields(actual, desired map[string]interface{}, fields []string) []string {
+	var differing []string
+
+	for _, field := range fields {
+		if !matches(actual[field], desired[field]) {
+			differing = append(differing, field)
+		}
+	}
+
+	return differing
+}
+
+// checks if actual matches desired. Nested objects only need to match the keys of desired,
+// because Graylog may add keys with defaults (e.g. to strategy configs).
+func matches(actual, desired interface{}) bool {
+	desiredMap, ok := desired.(map[string]interface{})
+	if !ok {
+		return reflect.DeepEqual(actual, desired)
+	}
+
+	actualMap, ok := actual.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for key, value := range desiredMap {
+		if !matches(actualMap[key], value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// returns desired, with the keys of actual not in desired kept for nested objects
+func merge(actual, desired interface{}) interface{} {
+	desiredMap, ok := desired.(map[string]interface{})
+	if !ok {
+		return desired
+	}
+
+	merged := make(map[string]interface{})
+	if actualMap, ok := actual.(map[string]interface{}); ok && matches(actualMap["type"], desiredMap["type"]) {
+		for key, value := range actualMap {
+			merged[key] = value
+		}
+	}
+
+	for key, value := range desiredMap {
+		merged[key] = merge(merged[key], value)
+	}
+
+	return merged
+}
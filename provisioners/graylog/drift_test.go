@@ -0,0 +1,40 @@
+package graylog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDifferingFieldsNested(t *testing.T) {
+
+	actual := map[string]interface{}{
+		"shards": float64(4),
+		"retention_strategy": map[string]interface{}{
+			"type":                  "DeletionRetentionStrategyConfig",
+			"max_number_of_indices": float64(14),
+			"index_action":          "delete",
+		},
+	}
+
+	desired := map[string]interface{}{
+		"shards": float64(2),
+		"retention_strategy": map[string]interface{}{
+			"type":                  "DeletionRetentionStrategyConfig",
+			"max_number_of_indices": float64(14),
+		},
+	}
+
+	drift := differingFields(actual, desired, []string{"shards", "retention_strategy"})
+	if !reflect.DeepEqual(drift, []string{"shards"}) {
+		t.Errorf("unexpected drift %v", drift)
+	}
+
+	merged := merge(actual["retention_strategy"], map[string]interface{}{
+		"type":                  "DeletionRetentionStrategyConfig",
+		"max_number_of_indices": float64(7),
+	}).(map[string]interface{})
+
+	if merged["index_action"] != "delete" || merged["max_number_of_indices"] != float64(7) {
+		t.Errorf("unexpected merge result %v", merged)
+	}
+}
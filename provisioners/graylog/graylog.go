@@ -1,155 +1,158 @@
 package graylog
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"io/ioutil"
-	"net/http"
-	"os"
-
-	"github.com/go-logr/logr"
+	"fmt"
+	"strings"
+
 	"github.com/pkg/errors"
 )
 
-type GraylogClient struct {
-	Url      string
-	User     string
-	Password string
-	Log      logr.Logger
-}
-
 type GraylogProvisioningData struct {
 
-	// Name is used as the Name / Title for all provisioned objects
+	// Name is the Namespace of the LoggingSetup. It is used for the ownership marker
+	// and to render the names of the provisioned objects (see Naming)
 	Name string
 
+	// OwnerUID is the UID of the LoggingSetup, it is part of the ownership marker
+	OwnerUID string
+
+	// ReportDriftOnly disables the correction of drift, it is only reported
+	ReportDriftOnly bool
+
 	// User data
 	User struct {
+		Name            string
 		InitialPassword string
 		Roles           []string
 
+		// AppliedRoles are the roles applied by the operator before, they are removed from the user
+		// if no longer desired. Set to Roles once they are applied (input and output)
+		AppliedRoles []string
+
 		ID string
+
+		// Adopt is set if ID references an existing object to take over
+		Adopt bool
+
+		// Drift contains the fields differing from the desired state (output)
+		Drift []string
+
+		// Result tells what has been done with the object (output)
+		Result ProvisionResult
 	}
 
 	// IndexSet data
 	IndexSet struct {
+		Title        string
+		IndexPrefix  string
 		TemplateName string
 
+		// optional overrides of the template settings
+		RetentionDays *int32
+		Shards        *int32
+		Replicas      *int32
+
 		ID string
+
+		// Adopt is set if ID references an existing object to take over
+		Adopt bool
+
+		// Drift contains the fields differing from the desired state (output)
+		Drift []string
+
+		// Result tells what has been done with the object (output)
+		Result ProvisionResult
 	}
 
 	// Stream data
 	Stream struct {
+		Title string
 
 		// The FieldName to match 'Name'
 		RuleFieldName string
 
-		ID string
-	}
-}
-
-func (client GraylogClient) Test(ctx context.Context) error {
-	return client.callAPIExpect(ctx, "GET", "/api/cluster", nil, nil, 200)
-}
-
-func (client GraylogClient) callAPIExpect(ctx context.Context, method, endpoint string, input, output interface{}, expectedStatusCode int) error {
-	sc, err := client.callAPI(ctx, method, endpoint, input, output)
-	if err != nil {
-		// no Wrap here, because we have the context information in callAPI
-		return err
-	}
-
-	if sc != expectedStatusCode {
-		return errors.Errorf("%s %s status %d, %d expected", method, endpoint, sc, expectedStatusCode)
-	}
-
-	return nil
-}
+		RemoveMatchesFromDefaultStream bool
 
-func (client GraylogClient) callAPI(ctx context.Context, method, endpoint string, input, output interface{}) (int, error) {
+		// The FieldName to match ClusterName, no cluster rule is created if one of them is empty
+		ClusterFieldName string
+		ClusterName      string
 
-	// prepare request
-	var (
-		req *http.Request
-		err error
-	)
+		ID string
 
-	log := client.Log.WithValues("method", method, "endpoint", endpoint)
+		// Adopt is set if ID references an existing object to take over
+		Adopt bool
 
-	// build request
-	reqBody := &bytes.Buffer{}
-	if input != nil {
-		if err := json.NewEncoder(reqBody).Encode(input); err != nil {
-			return 0, errors.Wrap(err, "failed to encode request body")
-		}
-	}
+		// Drift contains the fields differing from the desired state (output)
+		Drift []string
 
-	// make URL
-	url := client.Url + endpoint
+		// Result tells what has been done with the object (output)
+		Result ProvisionResult
 
-	req, err = http.NewRequest(method, url, reqBody)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to call http.NewRequest")
+		// Shared is set if the stream has been shared with the user (output)
+		Shared bool
 	}
+}
 
-	req = req.WithContext(ctx)
-
-	req.SetBasicAuth(client.User, client.Password)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Requested-By", "wd-k8s-operator")
+// ProvisionResult tells what a Provision function has done with an object
+type ProvisionResult string
 
-	// request
-	hc := &http.Client{}
-	resp, err := hc.Do(req)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to execute http request")
-	}
+const (
+	// the object was already provisioned
+	RESULT_EXISTING ProvisionResult = ""
+	RESULT_CREATED  ProvisionResult = "Created"
+	RESULT_ADOPTED  ProvisionResult = "Adopted"
+)
 
-	defer resp.Body.Close()
+// returns the marker written to descriptions (and emails) of owned objects.
+// It has the form of an email address, because it is used as the email of the user.
+func (data *GraylogProvisioningData) ownershipMarker() string {
+	return data.Name + "+" + data.OwnerUID + "@" + OPERATOR_INFO
+}
 
-	// read response to buffer so that we can log the body an decode the output
-	responseBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return resp.StatusCode, errors.Wrap(err, "failed to read response body")
-	}
+// checks if the marker of an object identifies it as owned by the LoggingSetup.
+// Markers written before the UID was included are accepted, if the name matches.
+func (data *GraylogProvisioningData) owns(marker string) bool {
+	return marker == data.ownershipMarker() || marker == data.Name+"@"+OPERATOR_INFO
+}
 
-	log.V(2).Info("GrayLogAPICall", "StatusCode", resp.StatusCode, "Body", string(responseBody))
+// NotOwnedError is returned if an object to update or delete doesn't carry the ownership marker
+// of the LoggingSetup, because the ID in the status may be stale or mistyped, or the object
+// with the same title belongs to someone else
+type NotOwnedError struct {
+	Kind   string
+	ID     string
+	Marker string
 
-	if output != nil {
-		if err := json.NewDecoder(bytes.NewReader(responseBody)).Decode(output); err != nil {
-			return resp.StatusCode, errors.Wrap(err, "failed to decode graylog API response body")
-		}
-	}
-
-	return resp.StatusCode, nil
+	// Action is the refused operation, e.g. "update" or "delete"
+	Action string
 }
 
-// returns a Client instance for API calls.
-// Reads GRAYLOG_URL, GRAYLOG_USER, GRAYLOG_PASSWORD environment variables
-func CreateClient(log logr.Logger) (GraylogClient, error) {
-
-	client := GraylogClient{
-		Url:      os.Getenv("GRAYLOG_URL"),
-		User:     os.Getenv("GRAYLOG_USER"),
-		Password: os.Getenv("GRAYLOG_PASSWORD"),
-		Log:      log,
-	}
+func (e *NotOwnedError) Error() string {
+	return fmt.Sprintf("%s '%s' is not owned by this LoggingSetup (found marker '%s'), refusing to %s it", e.Kind, e.ID, e.Marker, e.Action)
+}
 
-	if client.Url == "" {
-		return client, errors.New("Missing GRAYLOG_URL enviornment variable")
-	}
+// IsNotOwned returns true if err has been returned because an object isn't owned by the LoggingSetup
+func IsNotOwned(err error) bool {
+	var notOwned *NotOwnedError
+	return errors.As(err, &notOwned)
+}
 
-	if client.User == "" {
-		return client, errors.New("Missing GRAYLOG_USER enviornment variable")
+// checkAdoptable returns a NotOwnedError if the marker of an object to adopt identifies another LoggingSetup as owner,
+// because deleting one of them would delete the object of the other
+func (data *GraylogProvisioningData) checkAdoptable(kind, id, marker string) error {
+	if strings.HasSuffix(marker, "@"+OPERATOR_INFO) && !data.owns(marker) {
+		return &NotOwnedError{Kind: kind, ID: id, Marker: marker, Action: "adopt"}
 	}
+	return nil
+}
 
-	if client.Password == "" {
-		return client, errors.New("Missing GRAYLOG_PASSWORD enviornment variable")
+// checkOwned returns a NotOwnedError if the marker of an existing object doesn't identify it as owned.
+// Only the adopt path may write the marker to objects, that don't carry it yet.
+func (data *GraylogProvisioningData) checkOwned(kind, id, marker string) error {
+	if !data.owns(marker) {
+		return &NotOwnedError{Kind: kind, ID: id, Marker: marker, Action: "update"}
 	}
-
-	return client, nil
-
+	return nil
 }
 
 const OPERATOR_INFO = "wd-k8s-operator"
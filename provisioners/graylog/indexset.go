@@ -2,99 +2,327 @@ package graylog
 
 import (
 	"context"
+	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 )
 
-type glIndexSetBasicInfo struct {
-	Id    string `json:"id"`
-	Title string `json:"title"`
+// the settings of an indexset copied from the template, differences are corrected as drift
+var indexSetTemplateFields = []string{
+	"shards",
+	"replicas",
+	"rotation_strategy_class",
+	"rotation_strategy",
+	"retention_strategy_class",
+	"retention_strategy",
+	"index_analyzer",
+	"index_optimization_max_num_segments",
+	"index_optimization_disabled",
+	"field_type_refresh_interval",
 }
 
-type glIndexSetsBasicInfo struct {
-	IndexSets []glIndexSetBasicInfo `json:"index_sets"`
-	Total     int                   `json:"total"`
+const (
+	ROTATION_STRATEGY_TIME    = "org.graylog2.indexer.rotation.strategies.TimeBasedRotationStrategy"
+	RETENTION_STRATEGY_DELETE = "org.graylog2.indexer.retention.strategies.DeletionRetentionStrategy"
+)
+
+// returns the desired settings of the indexset: the settings of the template (if any) with the overrides of data.
+// Numbers are float64, as they are compared to decoded json.
+func desiredIndexSetSettings(data *GraylogProvisioningData, template IndexSet) map[string]interface{} {
+
+	desired := make(map[string]interface{})
+
+	if template != nil {
+		for _, field := range indexSetTemplateFields {
+			desired[field] = template[field]
+		}
+	}
+
+	if data.IndexSet.Shards != nil {
+		desired["shards"] = float64(*data.IndexSet.Shards)
+	}
+
+	if data.IndexSet.Replicas != nil {
+		desired["replicas"] = float64(*data.IndexSet.Replicas)
+	}
+
+	// rotate daily, and keep one index per day
+	if data.IndexSet.RetentionDays != nil {
+		desired["rotation_strategy_class"] = ROTATION_STRATEGY_TIME
+		desired["rotation_strategy"] = map[string]interface{}{
+			"type":            ROTATION_STRATEGY_TIME + "Config",
+			"rotation_period": "P1D",
+		}
+		desired["retention_strategy_class"] = RETENTION_STRATEGY_DELETE
+		desired["retention_strategy"] = map[string]interface{}{
+			"type":                  RETENTION_STRATEGY_DELETE + "Config",
+			"max_number_of_indices": float64(*data.IndexSet.RetentionDays),
+		}
+	}
+
+	return desired
 }
 
-func ProvisionIndexSet(ctx context.Context, log logr.Logger, data *GraylogProvisioningData) error {
+// adoptIndexSet takes over an existing indexset by writing the ownership marker to the description
+func adoptIndexSet(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, indexSet IndexSet) error {
 
-	var (
-		err    error
-		client GraylogClient
-	)
+	marker, _ := indexSet["description"].(string)
+	if err := data.checkAdoptable("IndexSet", data.IndexSet.ID, marker); err != nil {
+		return err
+	}
 
-	client, err = CreateClient(log)
+	indexSet["description"] = data.ownershipMarker()
+
+	err := api.UpdateIndexSet(ctx, data.IndexSet.ID, indexSet)
 	if err != nil {
-		return err
+		return errors.Wrapf(err, "Error adopting indexset '%s'", data.IndexSet.ID)
+	}
+
+	log.Info("IndexSet adopted", "indexSetID", data.IndexSet.ID, "title", indexSet["title"])
+	data.IndexSet.Result = RESULT_ADOPTED
+	return nil
+}
+
+// correctIndexSetDrift compares the indexset with the desired state and updates the differing fields.
+// Settings are compared with the template (if it exists) and the overrides. It must only be called for
+// owned indexsets, the description is only updated to migrate a legacy marker. The title is not compared,
+// because adopted indexsets keep their title.
+func correctIndexSetDrift(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, indexSet, template IndexSet) error {
+
+	desired := desiredIndexSetSettings(data, template)
+	desired["description"] = data.ownershipMarker()
+
+	fields := []string{"description"}
+	for _, field := range indexSetTemplateFields {
+		if _, ok := desired[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+
+	data.IndexSet.Drift = differingFields(indexSet, desired, fields)
+	if len(data.IndexSet.Drift) == 0 {
+		return nil
+	}
+
+	if data.ReportDriftOnly {
+		log.Info("IndexSet drift detected", "fields", data.IndexSet.Drift)
+		return nil
+	}
+
+	for _, field := range data.IndexSet.Drift {
+		indexSet[field] = merge(indexSet[field], desired[field])
+	}
+
+	err := api.UpdateIndexSet(ctx, data.IndexSet.ID, indexSet)
+	if err != nil {
+		return errors.Wrapf(err, "Error correcting drift of indexset '%s'", data.IndexSet.ID)
 	}
 
+	log.Info("IndexSet drift corrected", "fields", data.IndexSet.Drift)
+	return nil
+}
+
+func ProvisionIndexSet(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData) error {
+
 	// get all indexsets
-	sets := &glIndexSetsBasicInfo{}
-	err = client.callAPIExpect(ctx, "GET", "/api/system/indices/index_sets", nil, sets, 200)
+	sets, err := api.ListIndexSets(ctx)
 	if err != nil {
 		return err
 	}
 
-	// find our indexset
-	var templateIndexSetId string
-	for _, set := range sets.IndexSets {
-		if set.Title == data.Name {
-			data.IndexSet.ID = set.Id
-			log.Info("Indexset already provisioned")
-			return nil
+	// find the template and our indexset by title
+	var template, existing IndexSet
+	for _, set := range sets {
+		if set.Title() == data.IndexSet.Title {
+			existing = set
 		}
 
-		if set.Title == data.IndexSet.TemplateName {
-			templateIndexSetId = set.Id
+		if set.Title() == data.IndexSet.TemplateName {
+			template = set
 		}
 	}
 
-	log.Info("Create new IndexSet by Template", "TemplateId", templateIndexSetId)
+	// check a known or adopted indexset by ID, as the title may differ
+	if data.IndexSet.ID != "" {
+		indexSet, err := api.GetIndexSet(ctx, data.IndexSet.ID)
+		if err != nil {
+			return err
+		}
 
-	// fetch raw json for the indexset
-	indexSet := make(map[string]interface{})
-	err = client.callAPIExpect(ctx, "GET", "/api/system/indices/index_sets/"+templateIndexSetId, nil, &indexSet, 200)
-	if err != nil {
-		return err
+		if indexSet != nil {
+			if data.IndexSet.Adopt {
+				if err := adoptIndexSet(ctx, api, log, data, indexSet); err != nil {
+					return err
+				}
+			} else {
+				marker, _ := indexSet["description"].(string)
+				if err := data.checkOwned("IndexSet", data.IndexSet.ID, marker); err != nil {
+					return err
+				}
+				log.Info("Indexset already provisioned")
+			}
+
+			return correctIndexSetDrift(ctx, api, log, data, indexSet, template)
+		}
+
+		if data.IndexSet.Adopt {
+			return errors.Errorf("IndexSet '%s' to adopt not found", data.IndexSet.ID)
+		}
+	}
+
+	if existing != nil {
+		marker, _ := existing["description"].(string)
+		if err := data.checkOwned("IndexSet", existing.ID(), marker); err != nil {
+			return err
+		}
+		data.IndexSet.ID = existing.ID()
+		log.Info("Indexset already provisioned")
+		return correctIndexSetDrift(ctx, api, log, data, existing, template)
+	}
+
+	if template == nil {
+		return errors.Errorf("IndexSet template '%s' not found", data.IndexSet.TemplateName)
+	}
+
+	log.Info("Create new IndexSet by Template", "TemplateId", template["id"])
+
+	// copy the template to clone our indexset
+	indexSet := make(IndexSet)
+	for k, v := range template {
+		indexSet[k] = v
+	}
+
+	for field, value := range desiredIndexSetSettings(data, template) {
+		indexSet[field] = merge(indexSet[field], value)
 	}
 
 	// overwrite fields needed to clone our indexset
 	indexSet["id"] = nil
-	indexSet["title"] = data.Name
-	indexSet["description"] = data.Name + "@" + OPERATOR_INFO
-	indexSet["index_prefix"] = data.Name + "-"
+	indexSet["title"] = data.IndexSet.Title
+	indexSet["description"] = data.ownershipMarker()
+	indexSet["index_prefix"] = data.IndexSet.IndexPrefix
+	indexSet["default"] = false
 
 	// create the indexset
-	err = client.callAPIExpect(ctx, "POST", "/api/system/indices/index_sets", indexSet, nil, 200)
+	data.IndexSet.ID, err = api.CreateIndexSet(ctx, indexSet)
 	if err != nil {
 		return err
 	}
 
+	log.Info("IndexSet created", "indexSetID", data.IndexSet.ID)
+	data.IndexSet.Result = RESULT_CREATED
+
 	return nil
 }
 
-func DeleteIndexSet(ctx context.Context, log logr.Logger, id string) error {
+// TemplateSettings are the settings of an indexset template checked by the LoggingPolicies
+type TemplateSettings struct {
+	Shards *int32
+
+	// RetentionDays is only set for templates rotating by days and deleting the old indices
+	RetentionDays *int32
+}
+
+// GetTemplateSettings returns the settings of the indexset template with the given title, nil if it doesn't exist
+func GetTemplateSettings(ctx context.Context, api GraylogAPI, title string) (*TemplateSettings, error) {
+
+	sets, err := api.ListIndexSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, set := range sets {
+		if set.Title() == title {
+			return templateSettings(set), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func templateSettings(template IndexSet) *TemplateSettings {
+
+	settings := &TemplateSettings{}
+
+	if shards, ok := template["shards"].(float64); ok {
+		settings.Shards = int32Ptr(int32(shards))
+	}
+
+	if template["rotation_strategy_class"] != ROTATION_STRATEGY_TIME || template["retention_strategy_class"] != RETENTION_STRATEGY_DELETE {
+		return settings
+	}
+
+	rotation, _ := template["rotation_strategy"].(map[string]interface{})
+	retention, _ := template["retention_strategy"].(map[string]interface{})
+	period, _ := rotation["rotation_period"].(string)
+	indices, ok := retention["max_number_of_indices"].(float64)
+
+	if days := periodDays(period); days > 0 && ok {
+		settings.RetentionDays = int32Ptr(days * int32(indices))
+	}
+
+	return settings
+}
+
+// returns the days of an ISO 8601 period of days or weeks (e.g. P1D, P2W), 0 for other periods
+func periodDays(period string) int32 {
+
+	if !strings.HasPrefix(period, "P") || len(period) < 3 {
+		return 0
+	}
+
+	var factor int32
+	switch period[len(period)-1] {
+	case 'D':
+		factor = 1
+	case 'W':
+		factor = 7
+	default:
+		return 0
+	}
+
+	n, err := strconv.Atoi(period[1 : len(period)-1])
+	if err != nil {
+		return 0
+	}
+
+	return int32(n) * factor
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func DeleteIndexSet(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData) error {
 
 	var (
 		err error
 	)
 
-	log.Info("Delete IndexSet", "indesSetID", id)
+	id := data.IndexSet.ID
+	if id == "" {
+		return nil
+	}
+
+	log.Info("Delete IndexSet", "indexSetID", id)
 
-	client, err := CreateClient(log)
+	// verify the ownership, so that we never delete objects of others
+	indexSet, err := api.GetIndexSet(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	sc, err := client.callAPI(ctx, "DELETE", "/system/indices/index_sets/"+id, nil, nil)
-	if err != nil {
-		return err
+	if indexSet == nil {
+		log.Info("IndexSet already deleted")
+		return nil
 	}
 
-	if sc != 204 && sc != 404 {
-		return errors.Errorf("API Call returned status %d", sc)
+	marker, _ := indexSet["description"].(string)
+	if !data.owns(marker) {
+		return &NotOwnedError{Kind: "IndexSet", ID: id, Marker: marker, Action: "delete"}
 	}
 
-	return nil
+	return api.DeleteIndexSet(ctx, id)
 }
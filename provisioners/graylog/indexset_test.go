@@ -0,0 +1,55 @@
+package graylog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplateSettings(t *testing.T) {
+
+	daily := IndexSet{
+		"shards":                   float64(4),
+		"rotation_strategy_class":  ROTATION_STRATEGY_TIME,
+		"rotation_strategy":        map[string]interface{}{"rotation_period": "P1D"},
+		"retention_strategy_class": RETENTION_STRATEGY_DELETE,
+		"retention_strategy":       map[string]interface{}{"max_number_of_indices": float64(30)},
+	}
+
+	weekly := IndexSet{
+		"rotation_strategy_class":  ROTATION_STRATEGY_TIME,
+		"rotation_strategy":        map[string]interface{}{"rotation_period": "P1W"},
+		"retention_strategy_class": RETENTION_STRATEGY_DELETE,
+		"retention_strategy":       map[string]interface{}{"max_number_of_indices": float64(4)},
+	}
+
+	hourly := IndexSet{
+		"rotation_strategy_class":  ROTATION_STRATEGY_TIME,
+		"rotation_strategy":        map[string]interface{}{"rotation_period": "PT1H"},
+		"retention_strategy_class": RETENTION_STRATEGY_DELETE,
+		"retention_strategy":       map[string]interface{}{"max_number_of_indices": float64(24)},
+	}
+
+	bySize := IndexSet{
+		"shards":                   float64(1),
+		"rotation_strategy_class":  "org.graylog2.indexer.rotation.strategies.SizeBasedRotationStrategy",
+		"retention_strategy_class": RETENTION_STRATEGY_DELETE,
+		"retention_strategy":       map[string]interface{}{"max_number_of_indices": float64(20)},
+	}
+
+	tests := []struct {
+		name     string
+		template IndexSet
+		expected *TemplateSettings
+	}{
+		{"daily", daily, &TemplateSettings{Shards: int32Ptr(4), RetentionDays: int32Ptr(30)}},
+		{"weekly", weekly, &TemplateSettings{RetentionDays: int32Ptr(28)}},
+		{"hourly", hourly, &TemplateSettings{}},
+		{"by size", bySize, &TemplateSettings{Shards: int32Ptr(1)}},
+	}
+
+	for _, test := range tests {
+		if settings := templateSettings(test.template); !reflect.DeepEqual(settings, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, settings)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package graylog
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// the GELF input types of Graylog and their protocols
+var gelfInputProtocols = map[string]string{
+	"org.graylog2.inputs.gelf.udp.GELFUDPInput":   "udp",
+	"org.graylog2.inputs.gelf.tcp.GELFTCPInput":   "tcp",
+	"org.graylog2.inputs.gelf.http.GELFHttpInput": "http",
+}
+
+// GelfInput is an input of Graylog accepting GELF messages
+type GelfInput struct {
+	Title    string
+	Protocol string
+
+	// Host is the bind address of the input, or the host of the API if it binds to all addresses
+	Host string
+	Port int32
+	TLS  bool
+}
+
+// GetGelfInputs returns the GELF inputs configured in Graylog, ordered as returned by the API
+func GetGelfInputs(ctx context.Context, api GraylogAPI, log logr.Logger) ([]GelfInput, error) {
+
+	inputs, err := api.ListInputs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	apiHost := ""
+	if u, err := url.Parse(api.BaseURL()); err == nil {
+		apiHost = u.Hostname()
+	}
+
+	var result []GelfInput
+	for _, input := range inputs {
+		protocol, ok := gelfInputProtocols[input.Type]
+		if !ok {
+			continue
+		}
+
+		gelfInput := GelfInput{
+			Title:    input.Title,
+			Protocol: protocol,
+			Host:     apiHost,
+		}
+
+		if port, ok := input.Attributes["port"].(float64); ok {
+			gelfInput.Port = int32(port)
+		}
+
+		if tls, ok := input.Attributes["tls_enable"].(bool); ok {
+			gelfInput.TLS = tls
+		}
+
+		if bind, ok := input.Attributes["bind_address"].(string); ok && !isWildcardAddress(bind) {
+			gelfInput.Host = bind
+		}
+
+		result = append(result, gelfInput)
+	}
+
+	return result, nil
+}
+
+func isWildcardAddress(address string) bool {
+	address = strings.Trim(address, "[]")
+	if address == "" {
+		return true
+	}
+
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsUnspecified()
+}
@@ -0,0 +1,132 @@
+package graylog
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DEFAULT_NAME_TEMPLATE is the template used for user names and titles
+	DEFAULT_NAME_TEMPLATE = "{{.Namespace}}"
+
+	// DEFAULT_INDEX_PREFIX_TEMPLATE is the template used for index prefixes
+	DEFAULT_INDEX_PREFIX_TEMPLATE = "{{.Namespace}}-"
+)
+
+// NamingData is passed to the naming templates
+type NamingData struct {
+	// Cluster is the name of the cluster the operator runs in, may be empty
+	Cluster string
+
+	// Namespace of the LoggingSetup
+	Namespace string
+}
+
+// Naming renders the names of the Graylog objects from templates
+type Naming struct {
+	Cluster string
+
+	user          *template.Template
+	indexSetTitle *template.Template
+	indexPrefix   *template.Template
+	streamTitle   *template.Template
+}
+
+// Graylog only allows lowercase alphanumeric characters, '_', '+' and '-' in index prefixes,
+// and the prefix must start with an alphanumeric character
+var invalidIndexPrefixChars = regexp.MustCompile(`[^a-z0-9_+-]+`)
+
+// returns a Naming instance for the given templates.
+// Empty templates are replaced by the defaults.
+func NewNaming(cluster, user, indexSetTitle, indexPrefix, streamTitle string) (*Naming, error) {
+
+	var err error
+
+	naming := &Naming{Cluster: cluster}
+
+	parse := func(name, text, defaultText string) *template.Template {
+		if err != nil {
+			return nil
+		}
+
+		if text == "" {
+			text = defaultText
+		}
+
+		var t *template.Template
+		t, err = template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			err = errors.Wrapf(err, "invalid %s template", name)
+		}
+		return t
+	}
+
+	naming.user = parse("user", user, DEFAULT_NAME_TEMPLATE)
+	naming.indexSetTitle = parse("indexset", indexSetTitle, DEFAULT_NAME_TEMPLATE)
+	naming.indexPrefix = parse("indexprefix", indexPrefix, DEFAULT_INDEX_PREFIX_TEMPLATE)
+	naming.streamTitle = parse("stream", streamTitle, DEFAULT_NAME_TEMPLATE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return naming, nil
+}
+
+// Apply renders the names of all objects for the Namespace in data.Name
+func (naming *Naming) Apply(data *GraylogProvisioningData) error {
+
+	var err error
+
+	nd := NamingData{
+		Cluster:   naming.Cluster,
+		Namespace: data.Name,
+	}
+
+	if data.User.Name, err = render(naming.user, nd); err != nil {
+		return err
+	}
+
+	if data.IndexSet.Title, err = render(naming.indexSetTitle, nd); err != nil {
+		return err
+	}
+
+	prefix, err := render(naming.indexPrefix, nd)
+	if err != nil {
+		return err
+	}
+
+	if data.IndexSet.IndexPrefix = sanitizeIndexPrefix(prefix); data.IndexSet.IndexPrefix == "" {
+		return errors.Errorf("index prefix '%s' is empty after sanitizing", prefix)
+	}
+
+	if data.Stream.Title, err = render(naming.streamTitle, nd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func render(t *template.Template, nd NamingData) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, nd); err != nil {
+		return "", errors.Wrapf(err, "failed to render %s template", t.Name())
+	}
+
+	name := strings.TrimSpace(buf.String())
+	if name == "" {
+		return "", errors.Errorf("%s template rendered an empty name", t.Name())
+	}
+
+	return name, nil
+}
+
+func sanitizeIndexPrefix(prefix string) string {
+	prefix = strings.ToLower(prefix)
+	prefix = invalidIndexPrefixChars.ReplaceAllString(prefix, "-")
+	return strings.TrimLeft(prefix, "_+-")
+}
@@ -0,0 +1,61 @@
+package graylog
+
+import "testing"
+
+func TestNamingApply(t *testing.T) {
+
+	naming, err := NewNaming("Prod.EU", "{{.Cluster}}-{{.Namespace}}", "", "{{.Cluster}}_{{.Namespace}}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &GraylogProvisioningData{Name: "default"}
+	if err := naming.Apply(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data.User.Name != "Prod.EU-default" {
+		t.Errorf("unexpected user name %q", data.User.Name)
+	}
+
+	if data.IndexSet.Title != "default" {
+		t.Errorf("unexpected indexset title %q", data.IndexSet.Title)
+	}
+
+	if data.IndexSet.IndexPrefix != "prod-eu_default" {
+		t.Errorf("unexpected index prefix %q", data.IndexSet.IndexPrefix)
+	}
+
+	if data.Stream.Title != "default" {
+		t.Errorf("unexpected stream title %q", data.Stream.Title)
+	}
+}
+
+func TestNamingInvalidTemplate(t *testing.T) {
+	if _, err := NewNaming("", "{{.Cluster", "", "", ""); err == nil {
+		t.Error("expected an error for an unparsable template")
+	}
+
+	naming, err := NewNaming("", "", "", "{{.Unknown}}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := naming.Apply(&GraylogProvisioningData{Name: "default"}); err == nil {
+		t.Error("expected an error for an unknown template field")
+	}
+}
+
+func TestSanitizeIndexPrefix(t *testing.T) {
+	for in, expected := range map[string]string{
+		"default-":     "default-",
+		"My Namespace": "my-namespace",
+		"-_cluster+ns": "cluster+ns",
+		"a.b/c":        "a-b-c",
+		"---":          "",
+	} {
+		if actual := sanitizeIndexPrefix(in); actual != expected {
+			t.Errorf("sanitizeIndexPrefix(%q) = %q, expected %q", in, actual, expected)
+		}
+	}
+}
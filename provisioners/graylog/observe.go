@@ -0,0 +1,51 @@
+package graylog
+
+import (
+	"strings"
+	"time"
+)
+
+// RequestObserver is called after every request to the Graylog API, including retries.
+// The endpoint is a template with the IDs replaced by {id}, statusCode is 0 if no response has been received.
+type RequestObserver func(method, endpoint string, statusCode int, duration time.Duration)
+
+// the path segments followed by the ID or name of an object
+var endpointCollections = map[string]bool{
+	"users":      true,
+	"id":         true,
+	"tokens":     true,
+	"streams":    true,
+	"rules":      true,
+	"index_sets": true,
+	"entities":   true,
+}
+
+// the path segments following an ID, which are not an ID themselves
+var endpointSubresources = map[string]bool{
+	"id":          true,
+	"tokens":      true,
+	"rules":       true,
+	"resume":      true,
+	"throughput":  true,
+	"stats":       true,
+	"password":    true,
+	"permissions": true,
+}
+
+// endpointTemplate replaces the IDs and names of objects in endpoint by {id} and strips the query,
+// so that it can be used as a metric label
+func endpointTemplate(endpoint string) string {
+
+	if i := strings.IndexByte(endpoint, '?'); i >= 0 {
+		endpoint = endpoint[:i]
+	}
+
+	segments := strings.Split(endpoint, "/")
+	for i := 1; i < len(segments); i++ {
+		if endpointCollections[segments[i-1]] && !endpointSubresources[segments[i]] && segments[i] != "" {
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
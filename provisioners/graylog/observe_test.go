@@ -0,0 +1,22 @@
+package graylog
+
+import "testing"
+
+func TestEndpointTemplate(t *testing.T) {
+
+	for endpoint, expected := range map[string]string{
+		"/api/users/id/60a226a99e82ee1814ce0e92":                "/api/users/id/{id}",
+		"/api/users/tenant/tokens/ci":                           "/api/users/{id}/tokens/{id}",
+		"/api/users/60a226a99e82ee1814ce0e92/password":          "/api/users/{id}/password",
+		"/api/streams/60a242439e82ee1814ce2cd5/rules/abc":       "/api/streams/{id}/rules/{id}",
+		"/api/streams/60a242439e82ee1814ce2cd5/resume":          "/api/streams/{id}/resume",
+		"/api/system/indices/index_sets":                        "/api/system/indices/index_sets",
+		"/api/system/indices/index_sets/60a242439e82ee18/stats": "/api/system/indices/index_sets/{id}/stats",
+		"/api/authz/shares/entities/grn::::stream:60a2":         "/api/authz/shares/entities/{id}",
+		"/api/search/universal/relative?query=a&range=60":       "/api/search/universal/relative",
+	} {
+		if template := endpointTemplate(endpoint); template != expected {
+			t.Errorf("%s: expected %s, got %s", endpoint, expected, template)
+		}
+	}
+}
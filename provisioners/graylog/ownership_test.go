@@ -0,0 +1,96 @@
+package graylog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// fakeStreamAPI keeps streams in memory and counts the modifying calls, calls of other methods panic
+type fakeStreamAPI struct {
+	GraylogAPI
+
+	streams map[string]*Stream
+	changes int
+}
+
+func (api *fakeStreamAPI) GetStream(ctx context.Context, id string) (*Stream, error) {
+	return api.streams[id], nil
+}
+
+func (api *fakeStreamAPI) ListStreams(ctx context.Context) ([]Stream, error) {
+	var streams []Stream
+	for _, stream := range api.streams {
+		streams = append(streams, *stream)
+	}
+	return streams, nil
+}
+
+func (api *fakeStreamAPI) UpdateStream(ctx context.Context, id string, update *StreamUpdate) error {
+	api.changes++
+	return nil
+}
+
+func (api *fakeStreamAPI) AddStreamRule(ctx context.Context, id string, rule *StreamRule) error {
+	api.changes++
+	return nil
+}
+
+func (api *fakeStreamAPI) DeleteStream(ctx context.Context, id string) error {
+	api.changes++
+	delete(api.streams, id)
+	return nil
+}
+
+func TestForeignStreamAtStatusID(t *testing.T) {
+
+	foreign := &GraylogProvisioningData{Name: "other", OwnerUID: "other-uid"}
+
+	api := &fakeStreamAPI{streams: map[string]*Stream{
+		"s1": {Id: "s1", Title: "other", Description: foreign.ownershipMarker(), IndexSetID: "i2"},
+	}}
+
+	// the status of the LoggingSetup points to the stream of another LoggingSetup
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.Stream.ID = "s1"
+	data.Stream.Title = "tenant"
+	data.Stream.RuleFieldName = "namespace"
+	data.IndexSet.ID = "i1"
+
+	err := ProvisionStream(context.Background(), api, logr.Discard(), data)
+	if !IsNotOwned(err) {
+		t.Fatalf("expected a NotOwnedError while provisioning, got %v", err)
+	}
+
+	err = DeleteStream(context.Background(), api, logr.Discard(), data)
+	if !IsNotOwned(err) {
+		t.Fatalf("expected a NotOwnedError while deleting, got %v", err)
+	}
+
+	if api.changes != 0 || api.streams["s1"].Description != foreign.ownershipMarker() {
+		t.Errorf("foreign stream modified: %d changes, description %q", api.changes, api.streams["s1"].Description)
+	}
+}
+
+func TestAdoptStreamOfOtherLoggingSetup(t *testing.T) {
+
+	foreign := &GraylogProvisioningData{Name: "other", OwnerUID: "other-uid"}
+
+	api := &fakeStreamAPI{streams: map[string]*Stream{
+		"s1": {Id: "s1", Title: "other", Description: foreign.ownershipMarker()},
+	}}
+
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.Stream.ID = "s1"
+	data.Stream.Adopt = true
+
+	err := ProvisionStream(context.Background(), api, logr.Discard(), data)
+	if !IsNotOwned(err) {
+		t.Fatalf("expected a NotOwnedError, got %v", err)
+	}
+
+	if api.changes != 0 {
+		t.Errorf("stream of another LoggingSetup adopted with %d changes", api.changes)
+	}
+}
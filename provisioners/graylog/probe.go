@@ -0,0 +1,92 @@
+package graylog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PROBE_FIELD_NAME is the field identifying a probe message
+	PROBE_FIELD_NAME = "wd_probe_id"
+
+	PROBE_HOST = "wd-k8s-operator"
+)
+
+// layouts of the timestamps returned by the search API
+var probeTimestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.000"}
+
+// SendProbe sends a GELF message over UDP to address, with the fields matched by the stream rules of data.
+// The message is tagged with id, so it can be found by FindProbe.
+func SendProbe(ctx context.Context, log logr.Logger, address string, data *GraylogProvisioningData, id string) error {
+
+	now := time.Now()
+
+	message := map[string]interface{}{
+		"version":       "1.1",
+		"host":          PROBE_HOST,
+		"short_message": "wd-k8s-operator delivery probe " + id,
+		"timestamp":     float64(now.UnixNano()) / float64(time.Second),
+		"level":         6,
+
+		"_" + PROBE_FIELD_NAME:          id,
+		"_" + data.Stream.RuleFieldName: data.Name,
+	}
+
+	if data.Stream.ClusterFieldName != "" && data.Stream.ClusterName != "" {
+		message["_"+data.Stream.ClusterFieldName] = data.Stream.ClusterName
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode GELF message")
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to GELF input %s", address)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(payload); err != nil {
+		return errors.Wrapf(err, "failed to send GELF message to %s", address)
+	}
+
+	log.V(1).Info("Probe message sent", "id", id, "address", address)
+	return nil
+}
+
+// FindProbe searches the probe message with id in the stream of data, sent at most within the last age.
+// Returns the time Graylog received the message, or nil if it has not been found.
+func FindProbe(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, id string, age time.Duration) (*time.Time, error) {
+
+	// one extra minute, in case the clocks are not in sync
+	messages, err := api.SearchStream(ctx, data.Stream.ID, fmt.Sprintf("%s:%s", PROBE_FIELD_NAME, id), age+time.Minute, 1,
+		[]string{"timestamp", "gl2_receive_timestamp"})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	// older Graylog versions don't store the receive timestamp, so the time it has been found is used then
+	received := time.Now()
+	if s, ok := messages[0]["gl2_receive_timestamp"].(string); ok {
+		for _, layout := range probeTimestampLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				received = t
+				break
+			}
+		}
+	}
+
+	return &received, nil
+}
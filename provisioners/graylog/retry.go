@@ -0,0 +1,118 @@
+package graylog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// default settings of the retries and the rate limit
+const (
+	DEFAULT_MAX_RETRIES           = 3
+	DEFAULT_RETRY_INITIAL_BACKOFF = 500 * time.Millisecond
+	DEFAULT_RETRY_MAX_BACKOFF     = 10 * time.Second
+	DEFAULT_QPS                   = 10
+	DEFAULT_BURST                 = 20
+)
+
+// APIError is returned if the Graylog API responds with an unexpected status code
+type APIError struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s status %d", e.Method, e.Endpoint, e.StatusCode)
+}
+
+// IsTransient returns true if err is a failure which may succeed if retried later:
+// connection errors, timeouts and the status codes 429 and 5xx
+func IsTransient(err error) bool {
+
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return isTransientStatus(apiErr.StatusCode)
+	}
+
+	// connection refused or reset, but not errors of the TLS handshake like an unknown CA
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// the connection has been closed while reading the response
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func isTransientStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// shouldRetry decides if a call is repeated after the response (or transport error) of an attempt.
+// POST requests are not idempotent, so they are only repeated if Graylog rejected them with 429.
+func shouldRetry(method string, statusCode int, err error) bool {
+
+	if method == http.MethodPost {
+		return err == nil && statusCode == http.StatusTooManyRequests
+	}
+
+	if err != nil {
+		return IsTransient(err)
+	}
+
+	return isTransientStatus(statusCode)
+}
+
+// retryBackoff returns the delay before the retry following attempt (starting with 0),
+// doubling the initial backoff up to the maximum. A Retry-After header in seconds takes precedence.
+func (config *ClientConfig) retryBackoff(attempt int, resp *http.Response) time.Duration {
+
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			return capDuration(time.Duration(seconds)*time.Second, config.RetryMaxBackoff)
+		}
+	}
+
+	backoff := config.RetryInitialBackoff
+	for i := 0; i < attempt && backoff < config.RetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return capDuration(backoff, config.RetryMaxBackoff)
+}
+
+func capDuration(d, max time.Duration) time.Duration {
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+// sleep waits for d, or returns the error of the context if it is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package graylog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func testClient(t *testing.T, config ClientConfig) *GraylogClient {
+	config.MaxRetries = 2
+	config.RetryInitialBackoff = time.Millisecond
+	config.RetryMaxBackoff = time.Millisecond
+
+	client, err := NewClient(config, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	if err := testClient(t, ClientConfig{Url: server.URL}).Test(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestRetryPostOnlyOnTooManyRequests(t *testing.T) {
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/system" {
+			w.Write([]byte(`{"version": "4.1.0"}`))
+			return
+		}
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := testClient(t, ClientConfig{Url: server.URL}).CreateUser(context.Background(), &User{Username: "test"})
+	if !IsTransient(err) {
+		t.Errorf("expected a transient error, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+
+	config := &ClientConfig{RetryInitialBackoff: time.Second, RetryMaxBackoff: 5 * time.Second}
+
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if backoff := config.retryBackoff(attempt, nil); backoff != expected {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, expected, backoff)
+		}
+	}
+}
+
+func TestGetOptionalTruncatedBody(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "s1", "title": "tena`))
+	}))
+	defer server.Close()
+
+	stream, err := testClient(t, ClientConfig{Url: server.URL}).GetStream(context.Background(), "s1")
+	if err == nil || stream != nil {
+		t.Errorf("expected a decode error, got stream %v, error %v", stream, err)
+	}
+}
@@ -7,145 +7,305 @@ import (
 	"github.com/pkg/errors"
 )
 
-// StreamRule represents a stream rule.
-type glStreamRule struct {
-	ID          string `json:"id,omitempty"`
-	StreamID    string `json:"stream_id,omitempty"`
-	Field       string `json:"field,omitempty"`
-	Value       string `json:"value,omitempty"`
-	Description string `json:"description,omitempty"`
-	Type        int    `json:"type,omitempty"`
-	Inverted    bool   `json:"inverted,omitempty"`
-}
+// Graylog stream rule type for an exact match
+const STREAM_RULE_TYPE_EXACT = 1
+
+// adoptStream takes over an existing stream by writing the ownership marker to the description,
+// and shares it with the user like a created stream
+func adoptStream(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, stream *Stream) error {
+
+	if err := data.checkAdoptable("Stream", stream.Id, stream.Description); err != nil {
+		return err
+	}
+
+	update := &StreamUpdate{
+		Title:                          stream.Title,
+		Description:                    data.ownershipMarker(),
+		MatchingType:                   stream.MatchingType,
+		RemoveMatchesFromDefaultStream: stream.RemoveMatchesFromDefaultStream,
+		IndexSetID:                     stream.IndexSetID,
+	}
+
+	err := api.UpdateStream(ctx, stream.Id, update)
+	if err != nil {
+		return errors.Wrapf(err, "Error adopting stream '%s'", stream.Id)
+	}
+
+	log.Info("Stream adopted", "streamID", stream.Id, "title", stream.Title)
+	data.Stream.Result = RESULT_ADOPTED
+
+	if err := shareStream(ctx, api, log, stream.Id, data.User.ID); err != nil {
+		return err
+	}
 
-type glStream struct {
-	Id                             string         `json:"id,omitempty"`
-	Title                          string         `json:"title"`
-	Description                    string         `json:"description"`
-	Rules                          []glStreamRule `json:"rules"`
-	RemoveMatchesFromDefaultStream bool           `json:"remove_matches_from_default_stream"`
-	IndexSetID                     string         `json:"index_set_id"`
+	data.Stream.Shared = true
+	return nil
 }
 
-type glStreams struct {
-	Streams []glStream `json:"streams"`
+// returns the rules the stream must have: the Namespace and optionally the cluster
+func desiredStreamRules(data *GraylogProvisioningData) []StreamRule {
+	rules := []StreamRule{
+		{
+			Field: data.Stream.RuleFieldName,
+			Value: data.Name,
+			Type:  STREAM_RULE_TYPE_EXACT,
+		},
+	}
+
+	if data.Stream.ClusterFieldName != "" && data.Stream.ClusterName != "" {
+		rules = append(rules, StreamRule{
+			Field: data.Stream.ClusterFieldName,
+			Value: data.Stream.ClusterName,
+			Type:  STREAM_RULE_TYPE_EXACT,
+		})
+	}
+
+	return rules
 }
 
-func ProvisionStream(ctx context.Context, log logr.Logger, data *GraylogProvisioningData) error {
+// correctStreamDrift compares the stream with the desired state and updates the differing fields.
+// It must only be called for owned streams, the description is only updated to migrate a legacy marker.
+// Rules are matched by their field, so changed rules are updated in place, and additional rules are removed.
+// The title is not compared, because adopted streams keep their title.
+func correctStreamDrift(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, stream *Stream) error {
+
+	update := &StreamUpdate{
+		Title:                          stream.Title,
+		Description:                    stream.Description,
+		MatchingType:                   stream.MatchingType,
+		RemoveMatchesFromDefaultStream: stream.RemoveMatchesFromDefaultStream,
+		IndexSetID:                     stream.IndexSetID,
+	}
 
-	var (
-		err    error
-		client GraylogClient
-	)
+	if marker := data.ownershipMarker(); update.Description != marker {
+		data.Stream.Drift = append(data.Stream.Drift, "description")
+		update.Description = marker
+	}
+
+	if update.MatchingType != "AND" {
+		data.Stream.Drift = append(data.Stream.Drift, "matching_type")
+		update.MatchingType = "AND"
+	}
+
+	if update.RemoveMatchesFromDefaultStream != data.Stream.RemoveMatchesFromDefaultStream {
+		data.Stream.Drift = append(data.Stream.Drift, "remove_matches_from_default_stream")
+		update.RemoveMatchesFromDefaultStream = data.Stream.RemoveMatchesFromDefaultStream
+	}
+
+	if data.IndexSet.ID != "" && update.IndexSetID != data.IndexSet.ID {
+		data.Stream.Drift = append(data.Stream.Drift, "index_set_id")
+		update.IndexSetID = data.IndexSet.ID
+	}
+
+	streamChanged := len(data.Stream.Drift) > 0
+
+	// match the rules by field
+	var addRules, updateRules []StreamRule
+	matched := make(map[string]bool)
+	for _, rule := range desiredStreamRules(data) {
+		var existing *StreamRule
+		for i := range stream.Rules {
+			if stream.Rules[i].Field == rule.Field && !matched[stream.Rules[i].ID] {
+				existing = &stream.Rules[i]
+				break
+			}
+		}
+
+		if existing == nil {
+			addRules = append(addRules, rule)
+			data.Stream.Drift = append(data.Stream.Drift, "rules."+rule.Field)
+			continue
+		}
+
+		matched[existing.ID] = true
+		if existing.Value != rule.Value || existing.Type != rule.Type || existing.Inverted {
+			rule.ID = existing.ID
+			updateRules = append(updateRules, rule)
+			data.Stream.Drift = append(data.Stream.Drift, "rules."+rule.Field)
+		}
+	}
+
+	var deleteRules []StreamRule
+	for _, rule := range stream.Rules {
+		if !matched[rule.ID] {
+			deleteRules = append(deleteRules, rule)
+			data.Stream.Drift = append(data.Stream.Drift, "rules."+rule.Field)
+		}
+	}
+
+	if stream.Disabled {
+		data.Stream.Drift = append(data.Stream.Drift, "disabled")
+	}
+
+	if len(data.Stream.Drift) == 0 {
+		return nil
+	}
+
+	if data.ReportDriftOnly {
+		log.Info("Stream drift detected", "fields", data.Stream.Drift)
+		return nil
+	}
+
+	if streamChanged {
+		err := api.UpdateStream(ctx, stream.Id, update)
+		if err != nil {
+			return errors.Wrapf(err, "Error correcting drift of stream '%s'", stream.Id)
+		}
+	}
+
+	for _, rule := range addRules {
+		err := api.AddStreamRule(ctx, stream.Id, &rule)
+		if err != nil {
+			return errors.Wrapf(err, "Error adding rule for field '%s'", rule.Field)
+		}
+	}
+
+	for _, rule := range updateRules {
+		err := api.UpdateStreamRule(ctx, stream.Id, &rule)
+		if err != nil {
+			return errors.Wrapf(err, "Error updating rule for field '%s'", rule.Field)
+		}
+	}
+
+	for _, rule := range deleteRules {
+		err := api.DeleteStreamRule(ctx, stream.Id, rule.ID)
+		if err != nil {
+			return errors.Wrapf(err, "Error removing rule for field '%s'", rule.Field)
+		}
+	}
+
+	if stream.Disabled {
+		err := api.ResumeStream(ctx, stream.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("Stream drift corrected", "fields", data.Stream.Drift)
+	return nil
+}
+
+func shareStream(ctx context.Context, api GraylogAPI, log logr.Logger, streamID, userID string) error {
 
-	client, err = CreateClient(log)
+	err := api.ShareStream(ctx, streamID, userID)
 	if err != nil {
 		return err
 	}
 
+	log.Info("Stream shared", "userID", userID)
+
+	return nil
+}
+
+func ProvisionStream(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData) error {
+
+	// check a known or adopted stream by ID, as the title may differ
+	if data.Stream.ID != "" {
+		stream, err := api.GetStream(ctx, data.Stream.ID)
+		if err != nil {
+			return err
+		}
+
+		if stream != nil {
+			if data.Stream.Adopt {
+				if err := adoptStream(ctx, api, log, data, stream); err != nil {
+					return err
+				}
+				stream.Description = data.ownershipMarker()
+			} else {
+				if err := data.checkOwned("Stream", stream.Id, stream.Description); err != nil {
+					return err
+				}
+				log.Info("Stream already provisioned")
+			}
+
+			return correctStreamDrift(ctx, api, log, data, stream)
+		}
+
+		if data.Stream.Adopt {
+			return errors.Errorf("Stream '%s' to adopt not found", data.Stream.ID)
+		}
+	}
+
 	// check existing streams
-	streams := &glStreams{}
-	err = client.callAPIExpect(ctx, "GET", "/api/streams", nil, streams, 200)
+	streams, err := api.ListStreams(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, stream := range streams.Streams {
-		if stream.Title == data.Name {
+	for _, stream := range streams {
+		if stream.Title == data.Stream.Title {
+			if err := data.checkOwned("Stream", stream.Id, stream.Description); err != nil {
+				return err
+			}
 			log.Info("Stream already provisioned")
 			data.Stream.ID = stream.Id
-			return nil
+			return correctStreamDrift(ctx, api, log, data, &stream)
 		}
 	}
 
 	// create the stream
-	stream := glStream{
-		Title:                          data.Name,
-		Description:                    data.Name + "@" + OPERATOR_INFO,
+	stream := &Stream{
+		Title:                          data.Stream.Title,
+		Description:                    data.ownershipMarker(),
 		IndexSetID:                     data.IndexSet.ID,
-		RemoveMatchesFromDefaultStream: true,
-		Rules: []glStreamRule{
-			{
-				Field: data.Stream.RuleFieldName,
-				Value: data.Name,
-				Type:  1,
-			},
-		},
+		MatchingType:                   "AND",
+		RemoveMatchesFromDefaultStream: data.Stream.RemoveMatchesFromDefaultStream,
+		Rules:                          desiredStreamRules(data),
 	}
 
-	response := struct {
-		StreamId string `json:"stream_id"`
-	}{}
-
-	err = client.callAPIExpect(ctx, "POST", "/api/streams", stream, &response, 201)
+	data.Stream.ID, err = api.CreateStream(ctx, stream)
 	if err != nil {
 		return err
 	}
 
-	data.Stream.ID = response.StreamId
 	log.Info("Stream created", "stream", stream)
+	data.Stream.Result = RESULT_CREATED
 
 	// start the stream
-	err = client.callAPIExpect(ctx, "POST", "/api/streams/"+data.Stream.ID+"/resume", nil, nil, 204)
+	err = api.ResumeStream(ctx, data.Stream.ID)
 	if err != nil {
 		return err
 	}
 
 	log.Info("Stream started")
 
-	/* By inspecting the Rest Calls from the Graylog UI, we see the following POST call executed:
-
-	First there is a POST call to $GRAYLOG/api/authz/shares/entities/grn::::stream:60a242439e82ee1814ce2cd5/prepare, but it seems to be not
-	mandatory, as we can create shares successfully with curl without `/prepare`.
-
-	This is the call on "Save":
-	curl "$GRAYLOG/api/authz/shares/entities/grn::::stream:60a242439e82ee1814ce2cd5" \
-		  --data-raw '{"selected_grantee_capabilities":{"grn::::user:60a226a99e82ee1814ce0e92":"view"}}'
-
-	60a242439e82ee1814ce2cd5 is the ID of the Stream
-	60a226a99e82ee1814ce0e92 is the ID of the User
-
-	*/
-
-	grn := "grn::::stream:" + data.Stream.ID
-
-	share_request := struct {
-		Selected_grantee_capabilities map[string]interface{} `json:"selected_grantee_capabilities,omitempty"`
-	}{map[string]interface{}{
-		"grn::::user:" + data.User.ID: "view",
-	}}
-
-	err = client.callAPIExpect(ctx, "POST", "/api/authz/shares/entities/"+grn, share_request, nil, 200)
-	if err != nil {
+	if err := shareStream(ctx, api, log, data.Stream.ID, data.User.ID); err != nil {
 		return err
 	}
 
-	log.Info("Stream started")
-
+	data.Stream.Shared = true
 	return nil
 }
 
-func DeleteStream(ctx context.Context, log logr.Logger, id string) error {
+func DeleteStream(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData) error {
 
 	var (
 		err error
 	)
 
+	id := data.Stream.ID
+	if id == "" {
+		return nil
+	}
+
 	log.Info("Delete Stream", "streamID", id)
 
-	client, err := CreateClient(log)
+	// verify the ownership, so that we never delete objects of others
+	stream, err := api.GetStream(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	sc, err := client.callAPI(ctx, "DELETE", "/api/streams/"+id, nil, nil)
-	if err != nil {
-		return err
+	if stream == nil {
+		log.Info("Stream already deleted")
+		return nil
 	}
 
-	if sc != 204 && sc != 404 {
-		return errors.Errorf("API Call returned status %d", sc)
+	marker := stream.Description
+	if !data.owns(marker) {
+		return &NotOwnedError{Kind: "Stream", ID: id, Marker: marker, Action: "delete"}
 	}
 
-	return nil
+	return api.DeleteStream(ctx, id)
 }
@@ -0,0 +1,195 @@
+package graylog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TLSConfig contains the TLS settings of the connection to Graylog.
+// The files are read again when they change, e.g. if they are mounted from a Secret.
+// The settings are applied to direct connections only, not through an HTTPS_PROXY.
+type TLSConfig struct {
+
+	// CAFile is a PEM bundle of the CAs verifying the server certificate, the system CAs are used if empty
+	CAFile string
+
+	// CertFile and KeyFile are the PEM client certificate and key for mutual TLS
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name verified in the server certificate, the host of the URL is used if empty
+	ServerName string
+
+	// InsecureSkipVerify disables the verification of the server certificate
+	InsecureSkipVerify bool
+}
+
+// returns true if any setting differs from the default transport
+func (config TLSConfig) enabled() bool {
+	return config != TLSConfig{}
+}
+
+func (config TLSConfig) validate() error {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return errors.New("The client certificate and key files must be set together")
+	}
+	return nil
+}
+
+func (config TLSConfig) files() []string {
+	var files []string
+	for _, file := range []string{config.CAFile, config.CertFile, config.KeyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// tlsLoader provides the tls.Config for new connections, and loads the files again if they have been modified
+type tlsLoader struct {
+	config TLSConfig
+
+	// called after the files have been reloaded, to close connections with the old settings
+	onReload func()
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+	current  *tls.Config
+}
+
+func newTLSLoader(config TLSConfig) *tlsLoader {
+	return &tlsLoader{config: config}
+}
+
+// get returns the current tls.Config, it must not be modified
+func (loader *tlsLoader) get() (*tls.Config, error) {
+
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+
+	// Secrets are updated by replacing a symlink, so the modification time of the target is checked
+	modTimes := map[string]time.Time{}
+	for _, file := range loader.config.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read TLS file %s", file)
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	if loader.current != nil && equalModTimes(modTimes, loader.modTimes) {
+		return loader.current, nil
+	}
+
+	config, err := loader.load()
+	if err != nil {
+		return nil, err
+	}
+
+	reloaded := loader.current != nil
+	loader.current = config
+	loader.modTimes = modTimes
+
+	if reloaded && loader.onReload != nil {
+		loader.onReload()
+	}
+
+	return config, nil
+}
+
+func (loader *tlsLoader) load() (*tls.Config, error) {
+
+	config := &tls.Config{
+		ServerName:         loader.config.ServerName,
+		InsecureSkipVerify: loader.config.InsecureSkipVerify,
+	}
+
+	if loader.config.CAFile != "" {
+		pem, err := ioutil.ReadFile(loader.config.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the CA bundle")
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in the CA bundle %s", loader.config.CAFile)
+		}
+	}
+
+	if loader.config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(loader.config.CertFile, loader.config.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load the client certificate")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// dialTLS returns a DialTLSContext function of an http.Transport, using the current tls.Config for every connection
+func (loader *tlsLoader) dialTLS(dialer *net.Dialer, handshakeTimeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+
+		config, err := loader.get()
+		if err != nil {
+			return nil, err
+		}
+
+		if config.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			config = config.Clone()
+			config.ServerName = host
+		}
+
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(handshakeTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+
+		tlsConn := tls.Client(conn, config)
+		err = conn.SetDeadline(deadline)
+		if err == nil {
+			err = tlsConn.Handshake()
+		}
+		if err == nil {
+			err = conn.SetDeadline(time.Time{})
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return tlsConn, nil
+	}
+}
+
+func equalModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, t := range a {
+		if !t.Equal(b[file]) {
+			return false
+		}
+	}
+	return true
+}
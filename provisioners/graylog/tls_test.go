@@ -0,0 +1,35 @@
+package graylog
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSCustomCA(t *testing.T) {
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := ClientConfig{Url: server.URL}
+	if err := testClient(t, config).Test(context.Background()); err == nil {
+		t.Error("expected an error without the CA")
+	}
+
+	config.TLS.CAFile = caFile
+	if err := testClient(t, config).Test(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
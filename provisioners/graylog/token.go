@@ -0,0 +1,46 @@
+package graylog
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+)
+
+// CreateUserToken creates an access token for the user, and returns its ID and value.
+// Tokens of the user with the same name are revoked first, as they are left over if the ID couldn't be stored.
+func CreateUserToken(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, name string) (string, string, error) {
+
+	existing, err := api.ListUserTokens(ctx, data.User.ID)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Error listing tokens")
+	}
+
+	for _, token := range existing {
+		if token.Name != name {
+			continue
+		}
+
+		log.Info("Revoke left over Token", "userID", data.User.ID, "token", name, "tokenID", token.ID)
+		if err := api.DeleteUserToken(ctx, data.User.ID, token.ID); err != nil {
+			return "", "", errors.Wrapf(err, "Error revoking left over token '%s'", name)
+		}
+	}
+
+	log.Info("Create Token", "userID", data.User.ID, "token", name)
+
+	token, err := api.CreateUserToken(ctx, data.User.ID, name)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "Error creating token '%s'", name)
+	}
+
+	return token.ID, token.Token, nil
+}
+
+// DeleteUserToken revokes an access token of the user
+func DeleteUserToken(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, id string) error {
+
+	log.Info("Delete Token", "userID", data.User.ID, "tokenID", id)
+
+	return api.DeleteUserToken(ctx, data.User.ID, id)
+}
@@ -0,0 +1,70 @@
+package graylog
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+)
+
+// Usage contains the message throughput of the stream and the storage usage of the indexset
+type Usage struct {
+	Throughput int64
+
+	Indices   int64
+	Documents int64
+	SizeBytes int64
+
+	// OldestMessage is the begin of the oldest index range, nil if no range is calculated yet
+	OldestMessage *time.Time
+}
+
+// GetUsage reads the usage of the stream and indexset in data.
+// ranges are the index ranges of all indices, they are listed once for all LoggingSetups.
+func GetUsage(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, ranges []IndexRange) (*Usage, error) {
+
+	var (
+		err error
+	)
+
+	usage := &Usage{}
+
+	usage.Throughput, err = api.GetStreamThroughput(ctx, data.Stream.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := api.GetIndexSetStats(ctx, data.IndexSet.ID)
+	if err != nil {
+		return nil, err
+	}
+	usage.Indices = stats.Indices
+	usage.Documents = stats.Documents
+	usage.SizeBytes = stats.Size
+
+	// the ranges are only listed for all indices, so we filter them by the prefix of our indexset,
+	// which is read from Graylog because adopted indexsets have their own prefix
+	indexSet, err := api.GetIndexSet(ctx, data.IndexSet.ID)
+	if err != nil {
+		return nil, err
+	}
+	if indexSet == nil {
+		return nil, errors.Errorf("IndexSet %s not found", data.IndexSet.ID)
+	}
+	indexPrefix, _ := indexSet["index_prefix"].(string)
+
+	for _, r := range ranges {
+		if !strings.HasPrefix(r.IndexName, indexPrefix+"_") {
+			continue
+		}
+
+		if usage.OldestMessage == nil || r.Begin.Before(*usage.OldestMessage) {
+			begin := r.Begin
+			usage.OldestMessage = &begin
+		}
+	}
+
+	return usage, nil
+}
@@ -7,112 +7,184 @@ import (
 	"github.com/pkg/errors"
 )
 
-// User represents a user in the Graylog API
-type glUser struct {
-
-	// a unique user name used to log in with.
-	// ex. "local:admin"
-	Username string `json:"username,omitempty"`
-	// the contact email address
-	Email string `json:"email,omitempty"`
-	// a descriptive name for this account, e.g. the full name.
-	LastName  string `json:"last_name,omitempty"`
-	FirstName string `json:"first_name,omitempty"`
-	Password  string `json:"password,omitempty"`
-
-	ID string `json:"id,omitempty"`
-
-	Roles       []string `json:"roles,omitempty"`
-	Permissions []string `json:"permissions"`
+// adoptUser takes over an existing user by writing the ownership marker to the email
+func adoptUser(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, user *User) error {
+
+	if err := data.checkAdoptable("User", user.ID, user.Email); err != nil {
+		return err
+	}
+
+	update := &UserUpdate{Email: data.ownershipMarker()}
+
+	err := api.UpdateUser(ctx, user.ID, update)
+	if err != nil {
+		return errors.Wrapf(err, "Error adopting user '%s'", user.Username)
+	}
+
+	log.Info("User adopted", "userID", user.ID, "username", user.Username)
+	data.User.Result = RESULT_ADOPTED
+	return nil
 }
 
-func (client GraylogClient) tryGetUserByName(ctx context.Context, username string) (*glUser, error) {
-	user := &glUser{}
-	sc, err := client.callAPI(ctx, "GET", "/api/users/"+username, nil, user)
+// correctUserDrift compares the user with the desired state and updates the differing fields.
+// It must only be called for owned users, the email is only updated to migrate a legacy marker. Roles added in Graylog are kept,
+// missing roles are added again and roles applied by the operator before but no longer desired are removed.
+func correctUserDrift(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, user *User) error {
+
+	update := &UserUpdate{}
+
+	if marker := data.ownershipMarker(); user.Email != marker {
+		data.User.Drift = append(data.User.Drift, "email")
+		update.Email = marker
+	}
+
+	roles := removeItems(user.Roles, missingItems(data.User.Roles, data.User.AppliedRoles))
+	if missing := missingItems(roles, data.User.Roles); len(missing) > 0 || len(roles) != len(user.Roles) {
+		data.User.Drift = append(data.User.Drift, "roles")
+		update.Roles = append(roles, missing...)
+	}
 
-	switch sc {
-	case 200:
-		return user, nil
-	case 404:
-		return nil, nil
-	default:
-		return nil, err
+	if len(data.User.Drift) == 0 {
+		data.User.AppliedRoles = data.User.Roles
+		return nil
 	}
+
+	if data.ReportDriftOnly {
+		log.Info("User drift detected", "fields", data.User.Drift)
+		return nil
+	}
+
+	err := api.UpdateUser(ctx, user.ID, update)
+	if err != nil {
+		return errors.Wrapf(err, "Error correcting drift of user '%s'", user.Username)
+	}
+
+	log.Info("User drift corrected", "fields", data.User.Drift)
+	data.User.AppliedRoles = data.User.Roles
+	return nil
 }
 
-func ProvisionUser(ctx context.Context, log logr.Logger, data *GraylogProvisioningData) error {
+func ProvisionUser(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData) error {
 
 	var (
 		err error
 	)
 
-	log.Info("Start provisioning User", "GraylogUser", data.Name)
-
-	client, err := CreateClient(log)
-	if err != nil {
-		return err
+	log.Info("Start provisioning User", "GraylogUser", data.User.Name)
+
+	// check a known or adopted user by ID, as the name may differ
+	if data.User.ID != "" {
+		user, err := api.GetUserByID(ctx, data.User.ID)
+		if err != nil {
+			return err
+		}
+
+		if user != nil {
+			if data.User.Adopt {
+				if err := adoptUser(ctx, api, log, data, user); err != nil {
+					return err
+				}
+				user.Email = data.ownershipMarker()
+			} else {
+				if err := data.checkOwned("User", user.ID, user.Email); err != nil {
+					return err
+				}
+				log.Info("User already provisioned")
+			}
+
+			return correctUserDrift(ctx, api, log, data, user)
+		}
+
+		if data.User.Adopt {
+			return errors.Errorf("User '%s' to adopt not found", data.User.ID)
+		}
 	}
 
 	// check user existance
-	user, err := client.tryGetUserByName(ctx, data.Name)
+	user, err := api.GetUserByName(ctx, data.User.Name)
 	if user != nil {
+		if err := data.checkOwned("User", user.ID, user.Email); err != nil {
+			return err
+		}
 		data.User.ID = user.ID
 		log.Info("User already provisioned")
-		return nil
+		return correctUserDrift(ctx, api, log, data, user)
 	} else if err != nil {
 		return err
 	}
 
 	// initialize the user
-	user = &glUser{
-		Username:    data.Name,
-		FirstName:   data.Name,
-		LastName:    data.Name,
+	user = &User{
+		Username:    data.User.Name,
+		FirstName:   data.User.Name,
+		LastName:    data.User.Name,
 		Password:    data.User.InitialPassword,
-		Email:       data.Name + "@" + OPERATOR_INFO,
+		Email:       data.ownershipMarker(),
 		Roles:       data.User.Roles,
 		Permissions: []string{},
 	}
 
 	// create the user
-	err = client.callAPIExpect(ctx, "POST", "/api/users", user, nil, 201)
+	err = api.CreateUser(ctx, user)
 	if err != nil {
-		return errors.Wrapf(err, "Error creating user '%s'", data.Name)
+		return errors.Wrapf(err, "Error creating user '%s'", data.User.Name)
 	}
 
 	log.Info("User created")
+	data.User.Result = RESULT_CREATED
+	data.User.AppliedRoles = data.User.Roles
 
 	// No body is returned by the POST /api/users, so we need to read the ID with a new request
-	user, err = client.tryGetUserByName(ctx, data.Name)
+	user, err = api.GetUserByName(ctx, data.User.Name)
 	if err != nil {
 		return err
 	}
 
+	if user == nil {
+		return errors.Errorf("User '%s' not found after creating it", data.User.Name)
+	}
+
 	data.User.ID = user.ID
 
 	return nil
 }
 
-func DeleteUser(ctx context.Context, log logr.Logger, id string) error {
+func DeleteUser(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData) error {
 
-	var (
-		err error
-	)
+	id := data.User.ID
+	if id == "" {
+		return nil
+	}
 
 	log.Info("Delete User", "userID", id)
 
-	client, err := CreateClient(log)
+	// verify the ownership, so that we never delete objects of others
+	user, err := api.GetUserByID(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	sc, err := client.callAPI(ctx, "DELETE", "/api/users/id/"+id, nil, nil)
-	if err != nil {
-		return err
+	if user == nil {
+		log.Info("User already deleted")
+		return nil
+	}
+
+	marker := user.Email
+	if !data.owns(marker) {
+		return &NotOwnedError{Kind: "User", ID: id, Marker: marker, Action: "delete"}
 	}
 
-	if sc != 204 && sc != 404 {
-		return errors.Errorf("API Call returned status %d", sc)
+	return api.DeleteUser(ctx, id)
+}
+
+// SetUserPassword sets a new password for the user, the old password is not needed with admin permissions
+func SetUserPassword(ctx context.Context, api GraylogAPI, log logr.Logger, data *GraylogProvisioningData, password string) error {
+
+	log.Info("Set User password", "userID", data.User.ID)
+
+	err := api.SetUserPassword(ctx, data.User.ID, password)
+	if err != nil {
+		return errors.Wrapf(err, "Error setting password of user '%s'", data.User.Name)
 	}
 
 	return nil
@@ -0,0 +1,178 @@
+package graylog
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// fakeUserAPI keeps users in memory, calls of other methods panic
+type fakeUserAPI struct {
+	GraylogAPI
+
+	users   map[string]*User
+	updates []UserUpdate
+}
+
+func (api *fakeUserAPI) GetUserByName(ctx context.Context, username string) (*User, error) {
+	for _, user := range api.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (api *fakeUserAPI) GetUserByID(ctx context.Context, id string) (*User, error) {
+	return api.users[id], nil
+}
+
+func (api *fakeUserAPI) CreateUser(ctx context.Context, user *User) error {
+	created := *user
+	created.ID = "id-" + user.Username
+	api.users[created.ID] = &created
+	return nil
+}
+
+func (api *fakeUserAPI) UpdateUser(ctx context.Context, id string, update *UserUpdate) error {
+	api.updates = append(api.updates, *update)
+	return nil
+}
+
+func TestProvisionUserCreate(t *testing.T) {
+
+	api := &fakeUserAPI{users: map[string]*User{}}
+
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.User.Name = "tenant"
+	data.User.Roles = []string{"Reader"}
+
+	if err := ProvisionUser(context.Background(), api, logr.Discard(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data.User.ID != "id-tenant" || data.User.Result != RESULT_CREATED {
+		t.Errorf("unexpected result %q, ID %q", data.User.Result, data.User.ID)
+	}
+
+	if email := api.users["id-tenant"].Email; email != data.ownershipMarker() {
+		t.Errorf("unexpected email %q", email)
+	}
+}
+
+// lookupFailingUserAPI fails to read users by name, like an unavailable Graylog after creating the user
+type lookupFailingUserAPI struct {
+	fakeUserAPI
+}
+
+func (api *lookupFailingUserAPI) GetUserByName(ctx context.Context, username string) (*User, error) {
+	if len(api.users) > 0 {
+		return nil, errors.New("connection refused")
+	}
+	return nil, nil
+}
+
+func TestProvisionUserLookupFailsAfterCreate(t *testing.T) {
+
+	api := &lookupFailingUserAPI{fakeUserAPI{users: map[string]*User{}}}
+
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.User.Name = "tenant"
+
+	if err := ProvisionUser(context.Background(), api, logr.Discard(), data); err == nil {
+		t.Fatal("expected the failed lookup to be returned")
+	}
+
+	// the controller stores the generated password of created users, even if an error is returned
+	if data.User.Result != RESULT_CREATED {
+		t.Errorf("unexpected result %q", data.User.Result)
+	}
+}
+
+func TestProvisionUserDrift(t *testing.T) {
+
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.User.Name = "tenant"
+	data.User.ID = "1"
+	data.User.Roles = []string{"Reader"}
+
+	api := &fakeUserAPI{users: map[string]*User{
+		"1": {ID: "1", Username: "tenant", Email: data.ownershipMarker(), Roles: []string{"Admin"}},
+	}}
+
+	if err := ProvisionUser(context.Background(), api, logr.Discard(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []UserUpdate{{Roles: []string{"Admin", "Reader"}}}
+	if !reflect.DeepEqual(api.updates, expected) {
+		t.Errorf("unexpected updates %v", api.updates)
+	}
+}
+
+func TestProvisionUserRemovesAppliedRoles(t *testing.T) {
+
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.User.Name = "tenant"
+	data.User.ID = "1"
+	data.User.Roles = []string{"Reader"}
+	data.User.AppliedRoles = []string{"Reader", "Editor"}
+
+	api := &fakeUserAPI{users: map[string]*User{
+		"1": {ID: "1", Username: "tenant", Email: data.ownershipMarker(), Roles: []string{"Admin", "Reader", "Editor"}},
+	}}
+
+	if err := ProvisionUser(context.Background(), api, logr.Discard(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []UserUpdate{{Roles: []string{"Admin", "Reader"}}}
+	if !reflect.DeepEqual(api.updates, expected) {
+		t.Errorf("unexpected updates %v", api.updates)
+	}
+
+	if !reflect.DeepEqual(data.User.AppliedRoles, []string{"Reader"}) {
+		t.Errorf("unexpected applied roles %v", data.User.AppliedRoles)
+	}
+}
+
+func TestProvisionUserNotOwned(t *testing.T) {
+
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.User.Name = "tenant"
+
+	api := &fakeUserAPI{users: map[string]*User{
+		"1": {ID: "1", Username: "tenant", Email: "someone@example.com"},
+	}}
+
+	err := ProvisionUser(context.Background(), api, logr.Discard(), data)
+	if !IsNotOwned(err) {
+		t.Fatalf("expected a NotOwnedError, got %v", err)
+	}
+
+	if len(api.updates) != 0 || data.User.ID != "" {
+		t.Errorf("foreign user taken over: updates %v, ID %q", api.updates, data.User.ID)
+	}
+}
+
+func TestProvisionUserMigrateLegacyMarker(t *testing.T) {
+
+	data := &GraylogProvisioningData{Name: "tenant", OwnerUID: "uid"}
+	data.User.Name = "tenant"
+
+	api := &fakeUserAPI{users: map[string]*User{
+		"1": {ID: "1", Username: "tenant", Email: "tenant@" + OPERATOR_INFO},
+	}}
+
+	if err := ProvisionUser(context.Background(), api, logr.Discard(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []UserUpdate{{Email: data.ownershipMarker()}}
+	if !reflect.DeepEqual(api.updates, expected) {
+		t.Errorf("expected updates %v, got %v", expected, api.updates)
+	}
+}
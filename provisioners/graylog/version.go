@@ -0,0 +1,111 @@
+package graylog
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ServerVersion is the version of the Graylog server
+type ServerVersion struct {
+	Major int
+	Minor int
+	Patch int
+
+	// Raw is the version as reported by Graylog, e.g. "4.0.6+47a5f2b"
+	Raw string
+}
+
+var versionPattern = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+// ParseServerVersion parses the version reported by /api/system
+func ParseServerVersion(raw string) (*ServerVersion, error) {
+
+	match := versionPattern.FindStringSubmatch(raw)
+	if match == nil {
+		return nil, errors.Errorf("Invalid Graylog version '%s'", raw)
+	}
+
+	version := &ServerVersion{Raw: raw}
+	version.Major, _ = strconv.Atoi(match[1])
+	version.Minor, _ = strconv.Atoi(match[2])
+	version.Patch, _ = strconv.Atoi(match[3])
+
+	return version, nil
+}
+
+func (version *ServerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+}
+
+// AtLeast returns true if the version is major.minor or newer
+func (version *ServerVersion) AtLeast(major, minor int) bool {
+	return version.Major > major || (version.Major == major && version.Minor >= minor)
+}
+
+// SupportsEntityShares returns true if streams are shared through /api/authz/shares (Graylog 4).
+// Older versions grant permissions to the user instead.
+func (version *ServerVersion) SupportsEntityShares() bool {
+	return version.AtLeast(4, 0)
+}
+
+// AddressesUsersByID returns true if the user endpoints take the ID of the user (Graylog 4).
+// Older versions take the username.
+func (version *ServerVersion) AddressesUsersByID() bool {
+	return version.AtLeast(4, 0)
+}
+
+// SupportsSplitUserName returns true if users have a first and last name (Graylog 4.1).
+// Older versions only have a full name.
+func (version *ServerVersion) SupportsSplitUserName() bool {
+	return version.AtLeast(4, 1)
+}
+
+// ServerVersion returns the version of Graylog, it is read again after the connection failed or the session was renewed,
+// because Graylog may have been upgraded in the meantime
+func (client *GraylogClient) ServerVersion(ctx context.Context) (*ServerVersion, error) {
+
+	client.versionMu.Lock()
+	version := client.version
+	client.versionMu.Unlock()
+
+	if version != nil {
+		return version, nil
+	}
+
+	system := struct {
+		Version string `json:"version"`
+	}{}
+
+	err := client.callAPIExpect(ctx, "GET", "/api/system", nil, &system, 200)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the Graylog version")
+	}
+
+	version, err = ParseServerVersion(system.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	client.versionMu.Lock()
+	defer client.versionMu.Unlock()
+
+	if client.lastVersion != version.Raw {
+		client.Log.Info("Graylog version detected", "version", version.Raw)
+		client.lastVersion = version.Raw
+	}
+
+	client.version = version
+	return version, nil
+}
+
+// invalidateVersion forgets the version, so that it is read again by the next call
+func (client *GraylogClient) invalidateVersion() {
+	client.versionMu.Lock()
+	defer client.versionMu.Unlock()
+
+	client.version = nil
+}
@@ -0,0 +1,67 @@
+package graylog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseServerVersion(t *testing.T) {
+
+	version, err := ParseServerVersion("3.3.16+7f2f8aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version.String() != "3.3.16" || version.SupportsEntityShares() || version.AddressesUsersByID() {
+		t.Errorf("unexpected version %v", version)
+	}
+
+	version, err = ParseServerVersion("4.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !version.SupportsEntityShares() || !version.SupportsSplitUserName() {
+		t.Errorf("unexpected capabilities of %v", version)
+	}
+
+	if _, err := ParseServerVersion("unknown"); err == nil {
+		t.Error("expected an error for an invalid version")
+	}
+}
+
+func TestDeleteUserByVersion(t *testing.T) {
+
+	for version, expected := range map[string]string{
+		"3.3.16": "/api/users/tenant",
+		"4.1.0":  "/api/users/id/u1",
+	} {
+		deleted := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/api/system":
+				w.Write([]byte(`{"version": "` + version + `"}`))
+			case r.Method == "GET" && r.URL.Path == "/api/users/id/u1":
+				w.Write([]byte(`{"id": "u1", "username": "tenant"}`))
+			case r.Method == "DELETE":
+				deleted = r.URL.Path
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		err := testClient(t, ClientConfig{Url: server.URL}).DeleteUser(context.Background(), "u1")
+		server.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if deleted != expected {
+			t.Errorf("Graylog %s: expected DELETE %s, got %q", version, expected, deleted)
+		}
+	}
+}